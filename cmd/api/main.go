@@ -1,15 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/admin"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/audit"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/auth"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/export"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/config"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/mailer"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/signedtoken"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/db"
-	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore/minio"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore/backend"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/session"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/txn"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/types"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
 )
@@ -20,13 +33,7 @@ func main() {
 	cfg := config.MustLoad()
 
 	// filestore setup
-	minioClient, err := minio.New(
-		cfg.Endpoint,
-		cfg.AccessKey,
-		cfg.SecretKey,
-		cfg.Bucket,
-		cfg.UseSSL,
-	)
+	fileStore, err := backend.New(cfg)
 
 	if err != nil {
 		log.Fatal("failed to init storage: ", err)
@@ -39,10 +46,33 @@ func main() {
 		log.Fatal("failed to init db: ", err)
 	}
 
+	// mailer setup
+	mailSender, err := mailer.New(cfg)
+
+	if err != nil {
+		log.Fatal("failed to init mailer: ", err)
+	}
+
+	mailTemplates, err := mailer.LoadTemplates()
+
+	if err != nil {
+		log.Fatal("failed to load mail templates: ", err)
+	}
+
+	// emails are queued in the outbox inside the triggering transaction and delivered by the worker
+	outbox := mailer.NewOutbox(psql)
+	notifier := mailer.NewNotifier(outbox, mailTemplates)
+	outboxWorker := mailer.NewWorker(outbox, mailSender, mustParseDuration("mail.outbox_poll_interval", cfg.Mail.OutboxPollInterval), cfg.Mail.OutboxMaxAttempts, mustParseDuration("mail.outbox_retention", cfg.Mail.OutboxRetention))
+
 	// session setup
 	types.RegisterTypes()
 
-	store, err := session.NewRedisStore(cfg)
+	redisClient, err := db.NewRedisClient(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB)
+	if err != nil {
+		log.Fatal("failed to connect to redis: ", err, "\n")
+	}
+
+	store, err := session.NewRedisStore(redisClient, cfg)
 	if err != nil {
 		log.Fatal("failed to create session: ", err, "\n")
 	}
@@ -57,27 +87,110 @@ func main() {
 
 	// router setup
 	userRepo := user.NewRepository(psql)
-	authService := auth.NewService(minioClient, userRepo, "profile-pics")
-	authHandler := auth.NewHandler(authService, store, cfg.Cookies.Refresh.Name, cfg.Cookies.Refresh.Path, cfg.Refresh.Expiry, cfg.Cookies.Refresh.Secure, profilePicApiPrefix)
+	authRepo := auth.NewRepository(psql)
+	tokenOpts := auth.TokenOptions{
+		VerifyEmailUrl:         cfg.PublicURL + "/api/auth/verify-email",
+		VerificationExpiry:     mustParseDuration("auth.verification_expiry", cfg.Auth.VerificationExpiry),
+		VerificationCooldown:   mustParseDuration("auth.verification_resend_cooldown", cfg.Auth.VerificationResendCooldown),
+		ResetPasswordUrl:       cfg.Auth.PasswordResetUrl,
+		ResetPasswordExpiry:    mustParseDuration("auth.password_reset_expiry", cfg.Auth.PasswordResetExpiry),
+		ResetPasswordCooldown:  mustParseDuration("auth.password_reset_cooldown", cfg.Auth.PasswordResetCooldown),
+		ChangePasswordUrl:      cfg.Auth.PasswordChangeUrl,
+		ChangePasswordExpiry:   mustParseDuration("auth.password_change_expiry", cfg.Auth.PasswordChangeExpiry),
+		ChangePasswordCooldown: mustParseDuration("auth.password_change_cooldown", cfg.Auth.PasswordChangeCooldown),
+		ConfirmEmailChangeUrl:  cfg.PublicURL + "/api/auth/email/change/confirm",
+		CancelEmailChangeUrl:   cfg.PublicURL + "/api/auth/email/change/cancel",
+		ChangeEmailExpiry:      mustParseDuration("auth.email_change_expiry", cfg.Auth.EmailChangeExpiry),
+		ChangeEmailCooldown:    mustParseDuration("auth.email_change_cooldown", cfg.Auth.EmailChangeCooldown),
+	}
+	// failed logins are counted in redis, so the backoff holds across instances
+	loginThrottle := auth.NewLoginThrottle(auth.NewRedisAttemptStore(redisClient), auth.ThrottleOptions{
+		AccountFreeAttempts: cfg.LoginThrottle.AccountFreeAttempts,
+		IpFreeAttempts:      cfg.LoginThrottle.IpFreeAttempts,
+		BaseDelay:           mustParseDuration("login_throttle.base_delay", cfg.LoginThrottle.BaseDelay),
+		MaxDelay:            mustParseDuration("login_throttle.max_delay", cfg.LoginThrottle.MaxDelay),
+		Window:              mustParseDuration("login_throttle.window", cfg.LoginThrottle.Window),
+	})
+	authService := auth.NewService(fileStore, userRepo, authRepo, txn.NewTransactor(psql), notifier, signedtoken.New(cfg.Auth.TokenSecret), tokenOpts, "profile-pics", mustParseDuration("account.deletion_grace_period", cfg.Account.DeletionGracePeriod), loginThrottle)
+	authMiddleware := auth.NewMiddleware(store, userRepo, userRepo, cfg.Auth.RequireVerifiedEmail)
+	authHandler := auth.NewHandler(authService, store, authMiddleware, cfg.Cookies.Refresh.Name, cfg.Cookies.Refresh.Path, cfg.Refresh.Expiry, cfg.Cookies.Refresh.Secure, profilePicApiPrefix)
 	authRoutes := authHandler.RegisterRoutes()
 	mainMux.Handle("/api/auth/", http.StripPrefix("/api/auth", authRoutes))
 
-	authMiddleware := auth.NewMiddleware(store)
-	userHandler := user.NewHandler(authMiddleware.AuthMiddleware, userRepo, profilePicApiPrefix)
+	userService := user.NewService(userRepo, fileStore, "profile-pics")
+	userHandler := user.NewHandler(userService, authMiddleware.AuthMiddleware, userRepo, fileStore, cfg.MinIO.PresignProfilePics, mustParseDuration("minio.presigned_url_expiry", cfg.MinIO.PresignedURLExpiry), profilePicApiPrefix)
 	userRoutes := userHandler.RegisterRoutes()
 	mainMux.Handle("/api/user/", http.StripPrefix("/api/user", userRoutes))
+	authHandler.RegisterAccountRoutes(mainMux, "/api/user")
+
+	auditRepo := audit.NewRepository(psql)
+
+	exportService := export.NewService(export.NewRepository(psql), userRepo, authRepo, auditRepo, fileStore, cfg.Export.SyncLimit, mustParseDuration("export.expiry", cfg.Export.Expiry))
+	exportHandler := export.NewHandler(exportService, authMiddleware.AuthMiddleware)
+	exportHandler.RegisterRoutes(mainMux, "/api/user")
+	exportWorker := export.NewWorker(exportService, mustParseDuration("export.poll_interval", cfg.Export.PollInterval))
+
+	adminService := admin.NewService(userRepo, authRepo, auditRepo, txn.NewTransactor(psql))
+	adminHandler := admin.NewHandler(adminService, authMiddleware)
+	mainMux.Handle("/api/admin/", http.StripPrefix("/api/admin", adminHandler.RegisterRoutes()))
+
+	// accounts are purged for good once their deletion grace period is over
+	purger := user.NewPurger(userRepo, fileStore, exportService, mustParseDuration("account.purge_interval", cfg.Account.PurgeInterval))
 
 	server := http.Server{
 		Addr:    cfg.HTTPServer.Addr,
 		Handler: mainMux,
 	}
 
+	// background workers stop when the process is asked to terminate
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var workers sync.WaitGroup
+
+	workers.Go(func() {
+		outboxWorker.Run(ctx)
+	})
+
+	workers.Go(func() {
+		purger.Run(ctx)
+	})
+
+	workers.Go(func() {
+		exportWorker.Run(ctx)
+	})
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("failed to shutdown server gracefully: %s", err)
+		}
+	}()
+
 	// setup server
 	fmt.Println("Server started")
 	err = server.ListenAndServe()
 
-	if err != nil {
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal("failed to start server")
 	}
 
+	// make sure the workers stop even if the server failed on its own
+	stop()
+	workers.Wait()
+	fmt.Println("Server stopped")
+
+}
+
+func mustParseDuration(name, value string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid duration for %s: %s", name, err)
+	}
+
+	return d
 }
@@ -0,0 +1,57 @@
+// Command set-role changes the role of a user, e.g. to promote the first admin.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/config"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/db"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the user")
+	role := flag.String("role", user.RoleAdmin, "role to give the user, it must exist in the roles table")
+
+	// config setup, MustLoad parses the flags above together with -config
+	cfg := config.MustLoad()
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("-email is required")
+	}
+
+	psql, err := db.NewPostgresqlStorage(cfg.DbSource)
+	if err != nil {
+		log.Fatal("failed to init db: ", err)
+	}
+	defer psql.Close()
+
+	ctx := context.Background()
+	repo := user.NewRepository(psql)
+
+	u, err := repo.FindByEmail(ctx, *email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Fatalf("no user with email %s", *email)
+		}
+
+		log.Fatal("failed to find user: ", err)
+	}
+
+	if err := repo.UpdateRole(ctx, u.Id, *role); err != nil {
+		if errors.Is(err, user.ErrUnknownRole) {
+			log.Fatalf("unknown role %s", *role)
+		}
+
+		log.Fatal("failed to update role: ", err)
+	}
+
+	// sessions pick up the new role on their next request
+	fmt.Printf("%s is now %s (was %s)\n", u.Email, *role, u.Role)
+}
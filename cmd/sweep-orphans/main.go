@@ -0,0 +1,50 @@
+// Command sweep-orphans deletes profile pictures in the file store that no user references.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/config"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/db"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore/backend"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only print the orphaned objects")
+	minAge := flag.Duration("min-age", time.Hour, "skip objects younger than this, they may belong to a registration in progress")
+
+	// config setup, MustLoad parses the flags above together with -config
+	cfg := config.MustLoad()
+	flag.Parse()
+
+	fileStore, err := backend.New(cfg)
+	if err != nil {
+		log.Fatal("failed to init storage: ", err)
+	}
+
+	psql, err := db.NewPostgresqlStorage(cfg.DbSource)
+	if err != nil {
+		log.Fatal("failed to init db: ", err)
+	}
+	defer psql.Close()
+
+	sweeper := user.NewSweeper(user.NewRepository(psql), fileStore, "profile-pics/", *minAge)
+
+	orphans, err := sweeper.Sweep(context.Background(), *dryRun)
+	if err != nil {
+		log.Fatal("failed to sweep: ", err)
+	}
+
+	if *dryRun {
+		for _, name := range orphans {
+			fmt.Println(name)
+		}
+	}
+
+	fmt.Printf("%d orphaned profile pictures\n", len(orphans))
+}
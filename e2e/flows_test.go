@@ -0,0 +1,699 @@
+// Package e2e_test runs the register/login/logout/profile flows against the
+// API wired with in-memory stores.
+package e2e_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/testutil"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
+)
+
+const (
+	email    = "jane@example.com"
+	newEmail = "jane.doe@example.com"
+	password = "s3cret-password"
+	fullName = "Jane Doe"
+)
+
+type client struct {
+	http    *http.Client
+	baseURL string
+}
+
+type step struct {
+	name string
+	run  func(c *client, srv *testutil.Server) error
+}
+
+func TestFlows(t *testing.T) {
+	srv, err := testutil.NewServer()
+	if err != nil {
+		t.Fatal("failed to start server: ", err)
+	}
+	defer srv.Close()
+
+	c := &client{
+		http: &http.Client{
+			Jar: mustJar(),
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		baseURL: srv.URL,
+	}
+
+	steps := []step{
+		{"register", register},
+		{"register with a taken email", registerConflict},
+		{"register with a gif", registerAnother("gif@example.com", "avatar.gif", gifImage(80, 80), http.StatusCreated)},
+		{"register with a non-image", registerAnother("text@example.com", "avatar.png", []byte("not an image at all"), http.StatusBadRequest)},
+		{"register with a webp", registerAnother("webp@example.com", "avatar.webp", webpImage(), http.StatusCreated)},
+		{"register with a broken webp", registerAnother("badwebp@example.com", "avatar.webp", append([]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "not really a webp"...), http.StatusBadRequest)},
+		{"register with oversized dimensions", registerAnother("huge@example.com", "avatar.png", pngImage(9000, 1), http.StatusRequestEntityTooLarge)},
+		{"register without a picture", defaultAvatar},
+		{"register with json", registerJSON(`{"email":"json@example.com","password":"s3cret-password","fullName":"Json Doe"}`, "application/json; charset=utf-8", http.StatusCreated)},
+		{"register with invalid json", registerJSON(`{"email":"not-an-email","password":"s3cret-password","fullName":"Json Doe"}`, "application/json", http.StatusBadRequest)},
+		{"register with an unsupported content type", registerJSON(`email=x`, "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType)},
+		{"profile", expectStatus(http.MethodGet, "/api/user/profile", nil, http.StatusOK, email)},
+		{"auth status", expectStatus(http.MethodGet, "/api/auth/status", nil, http.StatusOK, `"isVerified":false`)},
+		{"profile picture", profilePicSize("", 300, 200)},
+		{"profile picture thumbnail", profilePicSize("64", 64, 64)},
+		{"profile picture medium", profilePicSize("256", 200, 200)},
+		{"profile picture unknown size", expectStatus(http.MethodGet, "/api/user/profile-pic?size=12", nil, http.StatusBadRequest, "")},
+		{"update profile", expectStatus(http.MethodPatch, "/api/user/profile", []byte(`{"fullName":"  Janet Doe "}`), http.StatusOK, `"fullName":"Janet Doe"`)},
+		{"update profile with a blank name", expectStatus(http.MethodPatch, "/api/user/profile", []byte(`{"fullName":"   "}`), http.StatusBadRequest, "")},
+		{"update profile without fields", expectStatus(http.MethodPatch, "/api/user/profile", []byte(`{}`), http.StatusBadRequest, "")},
+		{"replace profile picture", replaceProfilePic},
+		{"replaced profile picture", profilePicSize("", 120, 90)},
+		{"logout", expectStatus(http.MethodPost, "/api/auth/logout", nil, http.StatusNoContent, "")},
+		{"profile after logout", expectStatus(http.MethodGet, "/api/user/profile", nil, http.StatusUnauthorized, "")},
+		{"login", expectStatus(http.MethodPost, "/api/auth/login", loginBody(password), http.StatusCreated, email)},
+		{"profile after login", expectStatus(http.MethodGet, "/api/user/profile", nil, http.StatusOK, "Janet Doe")},
+		{"refresh", expectStatus(http.MethodPost, "/api/auth/refresh", nil, http.StatusOK, "")},
+		{"verify email", followMailedLink(email, "/api/auth/verify-email", true, http.StatusOK, "Email address verified")},
+		{"verify email twice", followMailedLink(email, "/api/auth/verify-email", false, http.StatusBadRequest, "")},
+		{"auth status after verification", expectStatus(http.MethodGet, "/api/auth/status", nil, http.StatusOK, `"isVerified":true`)},
+		{"sweep orphaned profile pictures", sweepOrphans},
+		{"change email with a wrong password", expectStatus(http.MethodPost, "/api/auth/email/change", []byte(`{"newEmail":"`+newEmail+`","currentPassword":"wrong-password1"}`), http.StatusUnauthorized, "")},
+		{"change email to a taken address", expectStatus(http.MethodPost, "/api/auth/email/change", []byte(`{"newEmail":"gif@example.com","currentPassword":"`+password+`"}`), http.StatusConflict, "")},
+		{"change email", expectStatus(http.MethodPost, "/api/auth/email/change", []byte(`{"newEmail":"`+newEmail+`","currentPassword":"`+password+`"}`), http.StatusAccepted, "")},
+		{"profile with a pending email", expectStatus(http.MethodGet, "/api/user/profile", nil, http.StatusOK, `"pendingEmail":"`+newEmail+`"`)},
+		{"cancel email change from the old address", followMailedLink(email, "/api/auth/email/change/cancel", true, http.StatusOK, "Email change cancelled")},
+		{"confirm a cancelled email change", followMailedLink(newEmail, "/api/auth/email/change/confirm", true, http.StatusBadRequest, "Something went wrong")},
+		{"change email again", expectStatus(http.MethodPost, "/api/auth/email/change", []byte(`{"newEmail":"`+newEmail+`","currentPassword":"`+password+`"}`), http.StatusAccepted, "")},
+		{"confirm email change from the new address", followMailedLink(newEmail, "/api/auth/email/change/confirm", false, http.StatusOK, `"email":"`+newEmail+`"`)},
+		{"cancel a confirmed email change", followMailedLink(email, "/api/auth/email/change/cancel", false, http.StatusBadRequest, "")},
+		{"login with the new email", expectStatus(http.MethodPost, "/api/auth/login", []byte(`{"email":"`+newEmail+`","password":"`+password+`"}`), http.StatusCreated, newEmail)},
+		{"delete account with a wrong password", expectStatus(http.MethodDelete, "/api/user/account", []byte(`{"password":"wrong-password1"}`), http.StatusUnauthorized, "")},
+		{"delete account", deleteAccount},
+		{"profile after deletion", expectStatus(http.MethodGet, "/api/user/profile", nil, http.StatusUnauthorized, "")},
+		{"login during the grace period", expectStatus(http.MethodPost, "/api/auth/login", []byte(`{"email":"`+newEmail+`","password":"`+password+`"}`), http.StatusCreated, newEmail)},
+		{"profile after restoring", expectStatus(http.MethodGet, "/api/user/profile", nil, http.StatusOK, newEmail)},
+		{"delete account again", deleteAccount},
+		{"purge after the grace period", purgeAccount},
+		{"login as the json account", expectStatus(http.MethodPost, "/api/auth/login", []byte(`{"email":"json@example.com","password":"`+password+`"}`), http.StatusCreated, "")},
+		{"export a small account", downloadExport("json@example.com", "")},
+		{"register a large account", registerAnother("large@example.com", "avatar.png", noisyPNG(800, 800), http.StatusCreated)},
+		{"login as the large account", expectStatus(http.MethodPost, "/api/auth/login", []byte(`{"email":"large@example.com","password":"`+password+`"}`), http.StatusCreated, "")},
+		{"export a large account", expectStatus(http.MethodGet, "/api/user/export", nil, http.StatusAccepted, "")},
+		{"export a large account again", expectStatus(http.MethodGet, "/api/user/export", nil, http.StatusAccepted, "")},
+		{"generate queued exports", generateExports(1)},
+		{"download a generated export", downloadExport("large@example.com", "profile-pic.png")},
+		{"purge an account with a generated export", purgeExportedAccount},
+		{"admin api as a regular user", expectStatus(http.MethodGet, "/api/admin/users", nil, http.StatusForbidden, "")},
+		{"promote to admin", promote("large@example.com")},
+		{"list users", expectStatus(http.MethodGet, "/api/admin/users?pageSize=2", nil, http.StatusOK, `"pageSize":2`)},
+		{"search users", expectStatus(http.MethodGet, "/api/admin/users?q=gif", nil, http.StatusOK, `"total":1`)},
+		{"list users with an invalid filter", expectStatus(http.MethodGet, "/api/admin/users?verified=maybe", nil, http.StatusBadRequest, "")},
+		{"manage a user", manageUser("json@example.com")},
+		{"suspend own account", suspendSelf("large@example.com")},
+		{"lock an account for a moment", lockBriefly("gif@example.com")},
+		{"login with an unknown email", expectStatus(http.MethodPost, "/api/auth/login", []byte(`{"email":"nobody@example.com","password":"`+password+`"}`), http.StatusUnauthorized, "invalid credentials")},
+		{"login with a wrong password", expectStatus(http.MethodPost, "/api/auth/login", []byte(`{"email":"gif@example.com","password":"wrong-password1"}`), http.StatusUnauthorized, "invalid credentials")},
+		{"throttle repeated failed logins", throttleLogin("gif@example.com")},
+	}
+
+	// the steps share one server and build on each other, so stop at the first failure
+	for _, s := range steps {
+		ok := t.Run(s.name, func(t *testing.T) {
+			if err := s.run(c, srv); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if !ok {
+			t.FailNow()
+		}
+	}
+}
+
+func register(c *client, srv *testutil.Server) error {
+	body, contentType, err := registerForm(email, "avatar.png", pngImage(300, 200))
+	if err != nil {
+		return err
+	}
+
+	res, err := c.do(http.MethodPost, "/api/auth/register", contentType, body)
+	if err != nil {
+		return err
+	}
+
+	if err := check(res, http.StatusCreated, email); err != nil {
+		return err
+	}
+
+	// the original and two thumbnails
+	if len(srv.FileStore.Names()) != 3 {
+		return fmt.Errorf("expected 3 stored profile pictures, got %d", len(srv.FileStore.Names()))
+	}
+
+	return nil
+}
+
+func registerConflict(c *client, srv *testutil.Server) error {
+	body, contentType, err := registerForm(email, "avatar.png", pngImage(300, 200))
+	if err != nil {
+		return err
+	}
+
+	res, err := c.do(http.MethodPost, "/api/auth/register", contentType, body)
+	if err != nil {
+		return err
+	}
+
+	return check(res, http.StatusConflict, "")
+}
+
+// profilePicSize fetches the caller's picture in the given size and checks its dimensions
+func profilePicSize(size string, width, height int) func(c *client, srv *testutil.Server) error {
+	return func(c *client, srv *testutil.Server) error {
+		res, err := c.do(http.MethodGet, "/api/user/profile-pic?size="+size, "", nil)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+		}
+
+		if contentType := res.Header.Get("Content-Type"); contentType != "image/png" {
+			return fmt.Errorf("expected image/png, got %q", contentType)
+		}
+
+		img, err := png.DecodeConfig(res.Body)
+		if err != nil {
+			return err
+		}
+
+		if img.Width != width || img.Height != height {
+			return fmt.Errorf("expected %dx%d, got %dx%d", width, height, img.Width, img.Height)
+		}
+
+		return nil
+	}
+}
+
+func replaceProfilePic(c *client, srv *testutil.Server) error {
+	before := len(srv.FileStore.Names())
+
+	var buf bytes.Buffer
+
+	form := multipart.NewWriter(&buf)
+
+	part, err := form.CreateFormFile("profilePic", "new.png")
+	if err != nil {
+		return err
+	}
+
+	part.Write(pngImage(120, 90))
+	form.Close()
+
+	res, err := c.do(http.MethodPut, "/api/user/profile-pic", form.FormDataContentType(), buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if err := check(res, http.StatusOK, ""); err != nil {
+		return err
+	}
+
+	// every size of the old picture is gone
+	if after := len(srv.FileStore.Names()); after != before {
+		return fmt.Errorf("expected %d stored objects after the swap, got %d", before, after)
+	}
+
+	return nil
+}
+
+// defaultAvatar registers without a picture and expects the same generated avatar on every request
+func defaultAvatar(c *client, srv *testutil.Server) error {
+	body, contentType, err := registerForm("nopic@example.com", "", nil)
+	if err != nil {
+		return err
+	}
+
+	other := &client{http: &http.Client{Jar: mustJar()}, baseURL: c.baseURL}
+
+	res, err := other.do(http.MethodPost, "/api/auth/register", contentType, body)
+	if err != nil {
+		return err
+	}
+
+	if err := check(res, http.StatusCreated, ""); err != nil {
+		return err
+	}
+
+	var avatars [][]byte
+
+	for range 2 {
+		res, err := other.do(http.MethodGet, "/api/user/profile-pic?size=64", "", nil)
+		if err != nil {
+			return err
+		}
+
+		avatar, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "image/png" {
+			return fmt.Errorf("expected a png, got %d %q", res.StatusCode, res.Header.Get("Content-Type"))
+		}
+
+		img, err := png.DecodeConfig(bytes.NewReader(avatar))
+		if err != nil {
+			return err
+		}
+
+		if img.Width != 64 || img.Height != 64 {
+			return fmt.Errorf("expected 64x64, got %dx%d", img.Width, img.Height)
+		}
+
+		avatars = append(avatars, avatar)
+	}
+
+	if !bytes.Equal(avatars[0], avatars[1]) {
+		return fmt.Errorf("default avatar is not deterministic")
+	}
+
+	return nil
+}
+
+func sweepOrphans(c *client, srv *testutil.Server) error {
+	ctx := context.Background()
+
+	const orphan = "profile-pics/orphan.png"
+
+	if err := srv.FileStore.Upload(ctx, orphan, strings.NewReader("orphan"), 6, "image/png"); err != nil {
+		return err
+	}
+
+	swept, err := srv.Sweeper.Sweep(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	if len(swept) != 1 || swept[0] != orphan {
+		return fmt.Errorf("expected only %s to be swept, got %v", orphan, swept)
+	}
+
+	// the registered user's picture must survive
+	res, err := c.do(http.MethodGet, "/api/user/profile-pic", "", nil)
+	if err != nil {
+		return err
+	}
+
+	return check(res, http.StatusOK, "")
+}
+
+// deleteAccount deletes the logged in account and checks it is hidden from everyone right away
+func deleteAccount(c *client, srv *testutil.Server) error {
+	res, err := c.do(http.MethodGet, "/api/user/profile", "", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var profile struct {
+		Data struct {
+			Id int64 `json:"id"`
+		} `json:"data"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&profile); err != nil {
+		return err
+	}
+
+	res, err = c.do(http.MethodDelete, "/api/user/account", "application/json", []byte(`{"password":"`+password+`"}`))
+	if err != nil {
+		return err
+	}
+
+	if err := check(res, http.StatusNoContent, ""); err != nil {
+		return err
+	}
+
+	res, err = c.do(http.MethodGet, fmt.Sprintf("/api/user/users/%d/profile-pic", profile.Data.Id), "", nil)
+	if err != nil {
+		return err
+	}
+
+	return check(res, http.StatusNotFound, "")
+}
+
+// purgeAccount waits out the grace period and checks the purger removes the account with its pictures
+func purgeAccount(c *client, srv *testutil.Server) error {
+	before := len(srv.FileStore.Names())
+
+	time.Sleep(1100 * time.Millisecond)
+
+	if purged := srv.Purger.PurgeDue(context.Background()); purged != 1 {
+		return fmt.Errorf("expected 1 purged account, got %d", purged)
+	}
+
+	// the original and two thumbnails
+	if removed := before - len(srv.FileStore.Names()); removed != 3 {
+		return fmt.Errorf("expected 3 profile pictures to be removed, got %d", removed)
+	}
+
+	res, err := c.do(http.MethodPost, "/api/auth/login", "application/json", []byte(`{"email":"`+newEmail+`","password":"`+password+`"}`))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusCreated {
+		return fmt.Errorf("expected login to fail after the purge")
+	}
+
+	return nil
+}
+
+// purgeExportedAccount purges an account whose archive is stored and checks the archive goes with it
+func purgeExportedAccount(c *client, srv *testutil.Server) error {
+	other := &client{http: &http.Client{Jar: mustJar()}, baseURL: c.baseURL}
+
+	body, contentType, err := registerForm("exported@example.com", "avatar.png", noisyPNG(800, 800))
+	if err != nil {
+		return err
+	}
+
+	res, err := other.do(http.MethodPost, "/api/auth/register", contentType, body)
+	if err != nil {
+		return err
+	}
+
+	if err := check(res, http.StatusCreated, ""); err != nil {
+		return err
+	}
+
+	res, err = other.do(http.MethodGet, "/api/user/export", "", nil)
+	if err != nil {
+		return err
+	}
+
+	if err := check(res, http.StatusAccepted, ""); err != nil {
+		return err
+	}
+
+	if err := generateExports(1)(other, srv); err != nil {
+		return err
+	}
+
+	archives := func() int {
+		n := 0
+		for _, name := range srv.FileStore.Names() {
+			if strings.HasPrefix(name, "exports/") {
+				n++
+			}
+		}
+		return n
+	}
+
+	before := archives()
+
+	if err := deleteAccount(other, srv); err != nil {
+		return err
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	if purged := srv.Purger.PurgeDue(context.Background()); purged != 1 {
+		return fmt.Errorf("expected 1 purged account, got %d", purged)
+	}
+
+	if removed := before - archives(); removed != 1 {
+		return fmt.Errorf("expected 1 archive to be removed, got %d", removed)
+	}
+
+	return nil
+}
+
+// downloadExport fetches the logged in user's archive and checks its entries. The archive
+// must carry the user's data and the export request, and never a password hash.
+func downloadExport(email, extraEntry string) func(c *client, srv *testutil.Server) error {
+	return func(c *client, srv *testutil.Server) error {
+		res, err := c.do(http.MethodGet, "/api/user/export", "", nil)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+		}
+
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			return err
+		}
+
+		expected := map[string]string{
+			"user.json":         `"email": "` + email + `"`,
+			"sessions.json":     `"userAgent"`,
+			"audit_events.json": `"action": "data_export.requested"`,
+		}
+		if extraEntry != "" {
+			expected[extraEntry] = ""
+		}
+
+		for _, f := range archive.File {
+			entry, err := f.Open()
+			if err != nil {
+				return err
+			}
+
+			content, err := io.ReadAll(entry)
+			entry.Close()
+			if err != nil {
+				return err
+			}
+
+			if bytes.Contains(content, []byte("$2a$")) {
+				return fmt.Errorf("%s contains a password hash", f.Name)
+			}
+
+			contains, ok := expected[f.Name]
+			if !ok {
+				return fmt.Errorf("unexpected archive entry %s", f.Name)
+			}
+
+			if !bytes.Contains(content, []byte(contains)) {
+				return fmt.Errorf("expected %s to contain %q, got: %s", f.Name, contains, content)
+			}
+
+			delete(expected, f.Name)
+		}
+
+		if len(expected) != 0 {
+			return fmt.Errorf("missing archive entries: %v", expected)
+		}
+
+		return nil
+	}
+}
+
+func generateExports(expected int) func(c *client, srv *testutil.Server) error {
+	return func(c *client, srv *testutil.Server) error {
+		if ready := srv.ExportWorker.ProcessDue(context.Background()); ready != expected {
+			return fmt.Errorf("expected %d generated exports, got %d", expected, ready)
+		}
+
+		return nil
+	}
+}
+
+// promote makes the user an admin, the logged in session picks the role up on its next request
+func promote(email string) func(c *client, srv *testutil.Server) error {
+	return func(c *client, srv *testutil.Server) error {
+		return srv.SetRole(context.Background(), email, user.RoleAdmin)
+	}
+}
+
+// manageUser runs every admin action against the user, checking each one is enforced
+// and ends up in the user's audit log. c must be logged in as an admin.
+func manageUser(email string) func(c *client, srv *testutil.Server) error {
+	return func(c *client, srv *testutil.Server) error {
+		id, err := findUserId(c, email)
+		if err != nil {
+			return err
+		}
+
+		path := fmt.Sprintf("/api/admin/users/%d", id)
+		other := &client{http: &http.Client{Jar: mustJar()}, baseURL: c.baseURL}
+		login := []byte(`{"email":"` + email + `","password":"` + password + `"}`)
+
+		actions := []struct {
+			c        *client
+			method   string
+			path     string
+			body     string
+			status   int
+			contains string
+		}{
+			{c, http.MethodPut, path + "/role", `{"role":"superuser"}`, http.StatusBadRequest, ""},
+			{c, http.MethodPut, path + "/role", `{"role":"user"}`, http.StatusOK, `"role":"user"`},
+			{c, http.MethodPost, path + "/verify", "", http.StatusOK, `"isVerified":true`},
+			{other, http.MethodPost, "/api/auth/login", string(login), http.StatusCreated, ""},
+			{c, http.MethodPost, path + "/suspend", `{"reason":"spam"}`, http.StatusOK, `"status":"suspended"`},
+			{other, http.MethodGet, "/api/user/profile", "", http.StatusForbidden, `"code":"account_suspended"`},
+			{other, http.MethodPost, "/api/auth/login", string(login), http.StatusForbidden, `"code":"account_suspended"`},
+			{c, http.MethodPost, path + "/unlock", "", http.StatusConflict, ""},
+			{c, http.MethodPost, path + "/unsuspend", "", http.StatusOK, `"status":"active"`},
+			{other, http.MethodPost, "/api/auth/login", string(login), http.StatusCreated, ""},
+			{c, http.MethodPost, path + "/lock", `{"reason":"compromised","until":"2000-01-01T00:00:00Z"}`, http.StatusBadRequest, ""},
+			{c, http.MethodPost, path + "/lock", `{"reason":"compromised","until":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`, http.StatusOK, `"status":"locked"`},
+			{other, http.MethodPost, "/api/auth/login", string(login), http.StatusForbidden, `"code":"account_locked"`},
+			{c, http.MethodPost, path + "/unlock", "", http.StatusOK, `"status":"active"`},
+			{other, http.MethodPost, "/api/auth/login", string(login), http.StatusCreated, ""},
+			{other, http.MethodGet, "/api/user/profile", "", http.StatusOK, email},
+			{c, http.MethodPost, path + "/logout", "", http.StatusNoContent, ""},
+			{other, http.MethodGet, "/api/user/profile", "", http.StatusUnauthorized, ""},
+			{c, http.MethodGet, path + "/audit-events", "", http.StatusOK, `"reason":"spam"`},
+			{c, http.MethodDelete, path, "", http.StatusNoContent, ""},
+			{c, http.MethodDelete, path, "", http.StatusConflict, ""},
+			{c, http.MethodGet, path, "", http.StatusOK, `"deletedAt"`},
+		}
+
+		for _, a := range actions {
+			contentType := ""
+			if a.body != "" {
+				contentType = "application/json"
+			}
+
+			res, err := a.c.do(a.method, a.path, contentType, []byte(a.body))
+			if err != nil {
+				return err
+			}
+
+			if err := check(res, a.status, a.contains); err != nil {
+				return fmt.Errorf("%s %s: %w", a.method, a.path, err)
+			}
+		}
+
+		return nil
+	}
+}
+
+func suspendSelf(email string) func(c *client, srv *testutil.Server) error {
+	return func(c *client, srv *testutil.Server) error {
+		id, err := findUserId(c, email)
+		if err != nil {
+			return err
+		}
+
+		res, err := c.do(http.MethodPost, fmt.Sprintf("/api/admin/users/%d/suspend", id), "application/json", []byte(`{"reason":"oops"}`))
+		if err != nil {
+			return err
+		}
+
+		return check(res, http.StatusBadRequest, "")
+	}
+}
+
+// lockBriefly locks the account for a second and checks it can log in again once the lock ran out
+func lockBriefly(email string) func(c *client, srv *testutil.Server) error {
+	return func(c *client, srv *testutil.Server) error {
+		id, err := findUserId(c, email)
+		if err != nil {
+			return err
+		}
+
+		until := time.Now().Add(time.Second).Format(time.RFC3339Nano)
+
+		res, err := c.do(http.MethodPost, fmt.Sprintf("/api/admin/users/%d/lock", id), "application/json", []byte(`{"reason":"checking","until":"`+until+`"}`))
+		if err != nil {
+			return err
+		}
+
+		if err := check(res, http.StatusOK, `"status":"locked"`); err != nil {
+			return err
+		}
+
+		other := &client{http: &http.Client{}, baseURL: c.baseURL}
+		login := []byte(`{"email":"` + email + `","password":"` + password + `"}`)
+
+		res, err = other.do(http.MethodPost, "/api/auth/login", "application/json", login)
+		if err != nil {
+			return err
+		}
+
+		if err := check(res, http.StatusForbidden, `"code":"account_locked"`); err != nil {
+			return err
+		}
+
+		time.Sleep(1100 * time.Millisecond)
+
+		res, err = other.do(http.MethodPost, "/api/auth/login", "application/json", login)
+		if err != nil {
+			return err
+		}
+
+		return check(res, http.StatusCreated, "")
+	}
+}
+
+// throttleLogin fails to log in until the account backs off, checks even the right password
+// is turned away meanwhile, and that it gets through once the wait is over
+func throttleLogin(email string) func(c *client, srv *testutil.Server) error {
+	return func(c *client, srv *testutil.Server) error {
+		other := &client{http: &http.Client{}, baseURL: c.baseURL}
+		wrong := []byte(`{"email":"` + email + `","password":"wrong-password1"}`)
+		right := []byte(`{"email":"` + email + `","password":"` + password + `"}`)
+
+		// the test server allows 3 free attempts, one was used by the previous step
+		for range 3 {
+			res, err := other.do(http.MethodPost, "/api/auth/login", "application/json", wrong)
+			if err != nil {
+				return err
+			}
+
+			if err := check(res, http.StatusUnauthorized, ""); err != nil {
+				return err
+			}
+		}
+
+		res, err := other.do(http.MethodPost, "/api/auth/login", "application/json", right)
+		if err != nil {
+			return err
+		}
+
+		if res.Header.Get("Retry-After") == "" {
+			res.Body.Close()
+			return fmt.Errorf("expected a Retry-After header")
+		}
+
+		if err := check(res, http.StatusTooManyRequests, ""); err != nil {
+			return err
+		}
+
+		time.Sleep(1100 * time.Millisecond)
+
+		res, err = other.do(http.MethodPost, "/api/auth/login", "application/json", right)
+		if err != nil {
+			return err
+		}
+
+		return check(res, http.StatusCreated, "")
+	}
+}
+
+// findUserId searches the users as an admin and returns the id of the one with the email
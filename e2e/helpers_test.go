@@ -0,0 +1,267 @@
+package e2e_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/testutil"
+)
+
+func findUserId(c *client, email string) (int64, error) {
+	res, err := c.do(http.MethodGet, "/api/admin/users?q="+url.QueryEscape(email), "", nil)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	var list struct {
+		Data struct {
+			Users []struct {
+				Id    int64  `json:"id"`
+				Email string `json:"email"`
+			} `json:"users"`
+		} `json:"data"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		return 0, err
+	}
+
+	for _, u := range list.Data.Users {
+		if u.Email == email {
+			return u.Id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("user %s not found", email)
+}
+
+func mustJar() http.CookieJar {
+	// cookiejar.New only fails on invalid options
+	jar, _ := cookiejar.New(nil)
+
+	return jar
+}
+
+// followMailedLink opens the last link to path mailed to the address and posts its form,
+// as a browser would when browser is set and as an api client otherwise
+func followMailedLink(to, path string, browser bool, status int, contains string) func(c *client, srv *testutil.Server) error {
+	pattern := regexp.MustCompile(regexp.QuoteMeta(path) + `\?token=[A-Za-z0-9_\-.%]+`)
+
+	return func(c *client, srv *testutil.Server) error {
+		messages := srv.Mailbox.Messages()
+
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].To != to {
+				continue
+			}
+
+			link := pattern.FindString(messages[i].TextBody)
+			if link == "" {
+				continue
+			}
+
+			// opening the link alone must not change anything
+			res, err := c.do(http.MethodGet, link, "", nil)
+			if err != nil {
+				return err
+			}
+
+			if err := check(res, http.StatusOK, `<form method="post">`); err != nil {
+				return err
+			}
+
+			token := link[strings.Index(link, "token=")+len("token="):]
+
+			req, err := http.NewRequest(http.MethodPost, c.baseURL+path, strings.NewReader("token="+token))
+			if err != nil {
+				return err
+			}
+
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if browser {
+				req.Header.Set("Accept", "text/html,application/xhtml+xml")
+			}
+
+			res, err = c.http.Do(req)
+			if err != nil {
+				return err
+			}
+
+			return check(res, status, contains)
+		}
+
+		return fmt.Errorf("no %s link was mailed to %s", path, to)
+	}
+}
+
+func expectStatus(method, path string, body []byte, status int, contains string) func(c *client, srv *testutil.Server) error {
+	return func(c *client, srv *testutil.Server) error {
+		contentType := ""
+		if body != nil {
+			contentType = "application/json"
+		}
+
+		res, err := c.do(method, path, contentType, body)
+		if err != nil {
+			return err
+		}
+
+		return check(res, status, contains)
+	}
+}
+
+func (c *client) do(method, path, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	return c.http.Do(req)
+}
+
+// check asserts the status code and that the body contains the given text, and closes the body
+func check(res *http.Response, status int, contains string) error {
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != status {
+		return fmt.Errorf("expected status %d, got %d: %s", status, res.StatusCode, body)
+	}
+
+	if contains != "" && !bytes.Contains(body, []byte(contains)) {
+		return fmt.Errorf("expected body to contain %q, got: %s", contains, body)
+	}
+
+	return nil
+}
+
+func loginBody(password string) []byte {
+	body, _ := json.Marshal(map[string]string{"email": email, "password": password})
+	return body
+}
+
+// registerAnother registers a second account from a fresh client, leaving c's session alone
+func registerAnother(email, filename string, picture []byte, status int) func(c *client, srv *testutil.Server) error {
+	return func(c *client, srv *testutil.Server) error {
+		body, contentType, err := registerForm(email, filename, picture)
+		if err != nil {
+			return err
+		}
+
+		other := &client{http: &http.Client{}, baseURL: c.baseURL}
+
+		res, err := other.do(http.MethodPost, "/api/auth/register", contentType, body)
+		if err != nil {
+			return err
+		}
+
+		return check(res, status, "")
+	}
+}
+
+// registerJSON posts body from a fresh client, leaving c's session alone
+func registerJSON(body, contentType string, status int) func(c *client, srv *testutil.Server) error {
+	return func(c *client, srv *testutil.Server) error {
+		other := &client{http: &http.Client{}, baseURL: c.baseURL}
+
+		res, err := other.do(http.MethodPost, "/api/auth/register", contentType, []byte(body))
+		if err != nil {
+			return err
+		}
+
+		return check(res, status, "")
+	}
+}
+
+func pngImage(width, height int) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)))
+	return buf.Bytes()
+}
+
+// noisyPNG does not compress, so its size grows with its dimensions
+func noisyPNG(width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	rand.Read(img.Pix)
+
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// webpImage is a 1x1 lossless webp
+func webpImage() []byte {
+	img, _ := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+
+	return img
+}
+
+func gifImage(width, height int) []byte {
+	var buf bytes.Buffer
+	gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9), nil)
+	return buf.Bytes()
+}
+
+func registerForm(email, filename string, picture []byte) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	form := multipart.NewWriter(&buf)
+
+	fields := map[string]string{"email": email, "password": password, "fullName": fullName}
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if picture == nil {
+		if err := form.Close(); err != nil {
+			return nil, "", err
+		}
+
+		return buf.Bytes(), form.FormDataContentType(), nil
+	}
+
+	// the server must not trust the declared type, so always claim a png
+	part, err := form.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="profilePic"; filename=%q`, filename)},
+		"Content-Type":        {"image/png"},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err := part.Write(picture); err != nil {
+		return nil, "", err
+	}
+
+	if err := form.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), form.FormDataContentType(), nil
+}
@@ -0,0 +1,42 @@
+package admin
+
+import "time"
+
+// UserResponse is a user as seen by admins
+type UserResponse struct {
+	Id           int64      `json:"id"`
+	Email        string     `json:"email"`
+	PendingEmail *string    `json:"pendingEmail,omitempty"`
+	Role         string     `json:"role"`
+	Status       string     `json:"status"`
+	StatusReason *string    `json:"statusReason,omitempty"`
+	StatusUntil  *time.Time `json:"statusUntil,omitempty"`
+	IsVerified   bool       `json:"isVerified"`
+	FullName     string     `json:"fullName"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	PurgeAt      *time.Time `json:"purgeAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+type UserListResponse struct {
+	Users    []UserResponse `json:"users"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+	Total    int            `json:"total"`
+}
+
+type ChangeRoleRequest struct {
+	Role string `json:"role" validate:"required,max=50"`
+}
+
+// SuspendRequest suspends indefinitely without Until
+type SuspendRequest struct {
+	Reason string     `json:"reason" validate:"required,max=500"`
+	Until  *time.Time `json:"until"`
+}
+
+type LockRequest struct {
+	Reason string    `json:"reason" validate:"required,max=500"`
+	Until  time.Time `json:"until" validate:"required"`
+}
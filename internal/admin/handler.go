@@ -0,0 +1,387 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/audit"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/auth"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/response"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type Service interface {
+	ListUsers(ctx context.Context, f user.Filter) ([]user.User, int, error)
+	GetUser(ctx context.Context, id int64) (*user.User, error)
+	ListAuditEvents(ctx context.Context, id int64) ([]audit.Event, error)
+	ChangeRole(ctx context.Context, actor Actor, id int64, role string) (*user.User, error)
+	Verify(ctx context.Context, actor Actor, id int64) (*user.User, error)
+	Suspend(ctx context.Context, actor Actor, id int64, reason string, until *time.Time) (*user.User, error)
+	Unsuspend(ctx context.Context, actor Actor, id int64) (*user.User, error)
+	Lock(ctx context.Context, actor Actor, id int64, reason string, until time.Time) (*user.User, error)
+	Unlock(ctx context.Context, actor Actor, id int64) (*user.User, error)
+	ForceLogout(ctx context.Context, actor Actor, id int64) error
+	DeleteUser(ctx context.Context, actor Actor, id int64) error
+}
+
+type Handler struct {
+	service    Service
+	middleware *auth.Middleware
+}
+
+func NewHandler(s Service, middleware *auth.Middleware) *Handler {
+	return &Handler{
+		service:    s,
+		middleware: middleware,
+	}
+}
+
+// ListUsers pages through the users, filtered by ?role=, ?verified=, ?createdAfter=,
+// ?createdBefore= and searched by ?q= on email and full name
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	page, ok := intParam(w, query.Get("page"), "page", 1, 1, math.MaxInt32)
+	if !ok {
+		return
+	}
+
+	pageSize, ok := intParam(w, query.Get("pageSize"), "pageSize", defaultPageSize, 1, maxPageSize)
+	if !ok {
+		return
+	}
+
+	filter := user.Filter{
+		Role:   query.Get("role"),
+		Query:  query.Get("q"),
+		Limit:  pageSize,
+		Offset: (page - 1) * pageSize,
+	}
+
+	if v := query.Get("verified"); v != "" {
+		verified, err := strconv.ParseBool(v)
+		if err != nil {
+			response.HandleBadRequest(w, "verified must be true or false")
+			return
+		}
+
+		filter.IsVerified = &verified
+	}
+
+	if filter.CreatedAfter, ok = timeParam(w, query.Get("createdAfter"), "createdAfter"); !ok {
+		return
+	}
+
+	if filter.CreatedBefore, ok = timeParam(w, query.Get("createdBefore"), "createdBefore"); !ok {
+		return
+	}
+
+	users, total, err := h.service.ListUsers(r.Context(), filter)
+
+	if err != nil {
+		response.HandleInternalError(w, "Error retriving users from db")
+		return
+	}
+
+	resData := UserListResponse{
+		Users:    make([]UserResponse, len(users)),
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}
+
+	for i := range users {
+		resData.Users[i] = userResponse(&users[i])
+	}
+
+	response.Retrived(w, "users", resData)
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	u, err := h.service.GetUser(r.Context(), id)
+
+	if err != nil {
+		handleActionError(w, err)
+		return
+	}
+
+	response.Retrived(w, "user", userResponse(u))
+}
+
+func (h *Handler) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := h.service.ListAuditEvents(r.Context(), id)
+
+	if err != nil {
+		handleActionError(w, err)
+		return
+	}
+
+	if events == nil {
+		events = []audit.Event{}
+	}
+
+	response.Retrived(w, "audit events", events)
+}
+
+func (h *Handler) ChangeRole(w http.ResponseWriter, r *http.Request) {
+	id, actor, ok := h.actionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var req ChangeRoleRequest
+
+	if ok := auth.DecodeAndValidate(w, r, &req); !ok {
+		return
+	}
+
+	u, err := h.service.ChangeRole(r.Context(), actor, id, req.Role)
+
+	if err != nil {
+		handleActionError(w, err)
+		return
+	}
+
+	response.Updated(w, "user", userResponse(u))
+}
+
+func (h *Handler) Verify(w http.ResponseWriter, r *http.Request) {
+	id, actor, ok := h.actionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	u, err := h.service.Verify(r.Context(), actor, id)
+
+	if err != nil {
+		handleActionError(w, err)
+		return
+	}
+
+	response.Updated(w, "user", userResponse(u))
+}
+
+func (h *Handler) Suspend(w http.ResponseWriter, r *http.Request) {
+	id, actor, ok := h.actionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var req SuspendRequest
+
+	if ok := auth.DecodeAndValidate(w, r, &req); !ok {
+		return
+	}
+
+	if req.Until != nil && !req.Until.After(time.Now()) {
+		response.HandleBadRequest(w, "until must be in the future")
+		return
+	}
+
+	u, err := h.service.Suspend(r.Context(), actor, id, req.Reason, req.Until)
+
+	if err != nil {
+		handleActionError(w, err)
+		return
+	}
+
+	response.Updated(w, "user", userResponse(u))
+}
+
+func (h *Handler) Unsuspend(w http.ResponseWriter, r *http.Request) {
+	id, actor, ok := h.actionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	u, err := h.service.Unsuspend(r.Context(), actor, id)
+
+	if err != nil {
+		handleActionError(w, err)
+		return
+	}
+
+	response.Updated(w, "user", userResponse(u))
+}
+
+func (h *Handler) Lock(w http.ResponseWriter, r *http.Request) {
+	id, actor, ok := h.actionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var req LockRequest
+
+	if ok := auth.DecodeAndValidate(w, r, &req); !ok {
+		return
+	}
+
+	if !req.Until.After(time.Now()) {
+		response.HandleBadRequest(w, "until must be in the future")
+		return
+	}
+
+	u, err := h.service.Lock(r.Context(), actor, id, req.Reason, req.Until)
+
+	if err != nil {
+		handleActionError(w, err)
+		return
+	}
+
+	response.Updated(w, "user", userResponse(u))
+}
+
+func (h *Handler) Unlock(w http.ResponseWriter, r *http.Request) {
+	id, actor, ok := h.actionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	u, err := h.service.Unlock(r.Context(), actor, id)
+
+	if err != nil {
+		handleActionError(w, err)
+		return
+	}
+
+	response.Updated(w, "user", userResponse(u))
+}
+
+func (h *Handler) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	id, actor, ok := h.actionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.ForceLogout(r.Context(), actor, id); err != nil {
+		handleActionError(w, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, actor, ok := h.actionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteUser(r.Context(), actor, id); err != nil {
+		handleActionError(w, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// actionTarget reads the target user from the path and the acting admin from the session
+func (h *Handler) actionTarget(w http.ResponseWriter, r *http.Request) (int64, Actor, bool) {
+	id, ok := userIdParam(w, r)
+	if !ok {
+		return 0, Actor{}, false
+	}
+
+	u, ok := user.GetUserFromContext(r.Context())
+
+	if !ok {
+		response.HandleInternalError(w, "Error retriving user from session")
+		return 0, Actor{}, false
+	}
+
+	return id, Actor{Id: u.UserID, IpAddress: auth.ClientInfoFromRequest(r).IpAddress}, true
+}
+
+func handleActionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		response.HandleNotFound(w, "User not found")
+	case errors.Is(err, ErrOwnAccount), errors.Is(err, user.ErrUnknownRole):
+		response.HandleBadRequest(w, err.Error())
+	case errors.Is(err, ErrAlreadyDeleted), errors.Is(err, ErrWrongStatus):
+		response.HandleConflict(w, err.Error())
+	default:
+		response.HandleInternalError(w, "Error while updating user")
+	}
+}
+
+func userResponse(u *user.User) UserResponse {
+	return UserResponse{
+		Id:           u.Id,
+		Email:        u.Email,
+		PendingEmail: u.PendingEmail,
+		Role:         u.Role,
+		Status:       u.Status,
+		StatusReason: u.StatusReason,
+		StatusUntil:  u.StatusUntil,
+		IsVerified:   u.IsVerified,
+		FullName:     u.FullName,
+		DeletedAt:    u.DeletedAt,
+		PurgeAt:      u.PurgeAt,
+		CreatedAt:    u.CreatedAt,
+		UpdatedAt:    u.UpdatedAt,
+	}
+}
+
+func userIdParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+
+	if err != nil || id <= 0 {
+		response.HandleBadRequest(w, "invalid user id")
+		return 0, false
+	}
+
+	return id, true
+}
+
+// intParam parses an optional query param within [min, max], writing a 400 when it is invalid
+func intParam(w http.ResponseWriter, value, name string, fallback, min, max int) (int, bool) {
+	if value == "" {
+		return fallback, true
+	}
+
+	n, err := strconv.Atoi(value)
+
+	if err != nil || n < min || n > max {
+		response.HandleBadRequest(w, name+" must be a number between "+strconv.Itoa(min)+" and "+strconv.Itoa(max))
+		return 0, false
+	}
+
+	return n, true
+}
+
+// timeParam parses an optional RFC 3339 timestamp or date, writing a 400 when it is invalid
+func timeParam(w http.ResponseWriter, value, name string) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, true
+		}
+	}
+
+	response.HandleBadRequest(w, name+" must be a date or an RFC 3339 timestamp")
+	return nil, false
+}
@@ -0,0 +1,208 @@
+package admin_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/admin"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/audit"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/auth"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/session"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/types"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/testutil"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
+)
+
+// stubService answers every call with the target user and counts the calls,
+// the tests only care whether a request gets through to it
+type stubService struct {
+	calls int
+}
+
+func (s *stubService) target(id int64) *user.User {
+	s.calls++
+	return &user.User{Id: id, Email: "target@example.com", Role: user.RoleUser, Status: user.StatusActive}
+}
+
+func (s *stubService) ListUsers(ctx context.Context, f user.Filter) ([]user.User, int, error) {
+	return []user.User{*s.target(2)}, 1, nil
+}
+
+func (s *stubService) GetUser(ctx context.Context, id int64) (*user.User, error) {
+	return s.target(id), nil
+}
+
+func (s *stubService) ListAuditEvents(ctx context.Context, id int64) ([]audit.Event, error) {
+	s.target(id)
+	return nil, nil
+}
+
+func (s *stubService) ChangeRole(ctx context.Context, actor admin.Actor, id int64, role string) (*user.User, error) {
+	return s.target(id), nil
+}
+
+func (s *stubService) Verify(ctx context.Context, actor admin.Actor, id int64) (*user.User, error) {
+	return s.target(id), nil
+}
+
+func (s *stubService) Suspend(ctx context.Context, actor admin.Actor, id int64, reason string, until *time.Time) (*user.User, error) {
+	return s.target(id), nil
+}
+
+func (s *stubService) Unsuspend(ctx context.Context, actor admin.Actor, id int64) (*user.User, error) {
+	return s.target(id), nil
+}
+
+func (s *stubService) Lock(ctx context.Context, actor admin.Actor, id int64, reason string, until time.Time) (*user.User, error) {
+	return s.target(id), nil
+}
+
+func (s *stubService) Unlock(ctx context.Context, actor admin.Actor, id int64) (*user.User, error) {
+	return s.target(id), nil
+}
+
+func (s *stubService) ForceLogout(ctx context.Context, actor admin.Actor, id int64) error {
+	s.target(id)
+	return nil
+}
+
+func (s *stubService) DeleteUser(ctx context.Context, actor admin.Actor, id int64) error {
+	s.target(id)
+	return nil
+}
+
+// accounts stands in for the users table and the role_permissions table
+type accounts struct {
+	users       map[int64]*user.User
+	permissions map[string][]string
+}
+
+func (a *accounts) FindById(ctx context.Context, id int64) (*user.User, error) {
+	u, ok := a.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return u, nil
+}
+
+func (a *accounts) ListRolePermissions(ctx context.Context, role string) ([]string, error) {
+	return a.permissions[role], nil
+}
+
+// sessionCookie logs the user in as they were when the session was issued
+func sessionCookie(t *testing.T, store *session.Store, u user.User) *http.Cookie {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	s, err := store.Get(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Values["user"] = types.UserSession{UserID: u.Id, Role: u.Role, IsVerified: u.IsVerified, SessionVersion: u.SessionVersion}
+
+	if err := store.Save(r, w, s); err != nil {
+		t.Fatal(err)
+	}
+
+	return w.Result().Cookies()[0]
+}
+
+func TestRoutesRequirePermissions(t *testing.T) {
+	types.RegisterTypes()
+
+	store, err := session.NewMemoryStore(testutil.Config("http://localhost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suspendedUntil := time.Now().Add(time.Hour)
+
+	accounts := &accounts{
+		users: map[int64]*user.User{
+			1:  {Id: 1, Role: user.RoleAdmin, Status: user.StatusActive, IsVerified: true},
+			10: {Id: 10, Role: user.RoleUser, Status: user.StatusActive, IsVerified: true},
+			11: {Id: 11, Role: "support", Status: user.StatusActive, IsVerified: true},
+			12: {Id: 12, Role: "auditor", Status: user.StatusActive, IsVerified: true},
+			13: {Id: 13, Role: user.RoleAdmin, Status: user.StatusSuspended, StatusUntil: &suspendedUntil, IsVerified: true},
+			// demoted since the session was issued, which still says admin
+			14: {Id: 14, Role: user.RoleUser, Status: user.StatusActive, IsVerified: true},
+		},
+		permissions: map[string][]string{
+			user.RoleAdmin: {user.PermissionUsersRead, user.PermissionUsersWrite, user.PermissionUsersDelete, user.PermissionAuditRead},
+			"support":      {user.PermissionUsersRead, user.PermissionUsersWrite},
+			"auditor":      {user.PermissionAuditRead},
+		},
+	}
+
+	sessionOf := func(id int64) *user.User {
+		u := *accounts.users[id]
+		if id == 14 {
+			u.Role = user.RoleAdmin
+		}
+		return &u
+	}
+
+	tests := []struct {
+		name       string
+		as         *user.User
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"anonymous", nil, http.MethodGet, "/users", "", http.StatusUnauthorized},
+		{"user lists users", sessionOf(10), http.MethodGet, "/users", "", http.StatusForbidden},
+		{"admin lists users", sessionOf(1), http.MethodGet, "/users", "", http.StatusOK},
+		{"admin reads the audit log", sessionOf(1), http.MethodGet, "/users/2/audit-events", "", http.StatusOK},
+		{"admin deletes a user", sessionOf(1), http.MethodDelete, "/users/2", "", http.StatusNoContent},
+		{"support lists users", sessionOf(11), http.MethodGet, "/users", "", http.StatusOK},
+		{"support views a user", sessionOf(11), http.MethodGet, "/users/2", "", http.StatusOK},
+		{"support changes a role", sessionOf(11), http.MethodPut, "/users/2/role", `{"role":"user"}`, http.StatusOK},
+		{"support verifies a user", sessionOf(11), http.MethodPost, "/users/2/verify", "", http.StatusOK},
+		{"support deletes a user", sessionOf(11), http.MethodDelete, "/users/2", "", http.StatusForbidden},
+		{"support reads the audit log", sessionOf(11), http.MethodGet, "/users/2/audit-events", "", http.StatusForbidden},
+		{"auditor reads the audit log", sessionOf(12), http.MethodGet, "/users/2/audit-events", "", http.StatusOK},
+		{"auditor lists users", sessionOf(12), http.MethodGet, "/users", "", http.StatusForbidden},
+		{"auditor logs a user out", sessionOf(12), http.MethodPost, "/users/2/logout", "", http.StatusForbidden},
+		{"suspended admin", sessionOf(13), http.MethodGet, "/users", "", http.StatusForbidden},
+		{"demoted admin", sessionOf(14), http.MethodGet, "/users", "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &stubService{}
+			middleware := auth.NewMiddleware(store, accounts, accounts, true)
+			routes := admin.NewHandler(service, middleware).RegisterRoutes()
+
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+
+			if tt.as != nil {
+				r.AddCookie(sessionCookie(t, store, *tt.as))
+			}
+
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			// a refused request must not reach the service at all
+			if reached := service.calls > 0; reached != (tt.wantStatus < 400) {
+				t.Fatalf("expected the service to be reached %t, got %d calls", tt.wantStatus < 400, service.calls)
+			}
+		})
+	}
+}
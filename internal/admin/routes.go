@@ -0,0 +1,29 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
+)
+
+func (h *Handler) RegisterRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users", h.guard(user.PermissionUsersRead, h.ListUsers))
+	mux.HandleFunc("GET /users/{id}", h.guard(user.PermissionUsersRead, h.GetUser))
+	mux.HandleFunc("GET /users/{id}/audit-events", h.guard(user.PermissionAuditRead, h.ListAuditEvents))
+	mux.HandleFunc("PUT /users/{id}/role", h.guard(user.PermissionUsersWrite, h.ChangeRole))
+	mux.HandleFunc("POST /users/{id}/verify", h.guard(user.PermissionUsersWrite, h.Verify))
+	mux.HandleFunc("POST /users/{id}/suspend", h.guard(user.PermissionUsersWrite, h.Suspend))
+	mux.HandleFunc("POST /users/{id}/unsuspend", h.guard(user.PermissionUsersWrite, h.Unsuspend))
+	mux.HandleFunc("POST /users/{id}/lock", h.guard(user.PermissionUsersWrite, h.Lock))
+	mux.HandleFunc("POST /users/{id}/unlock", h.guard(user.PermissionUsersWrite, h.Unlock))
+	mux.HandleFunc("POST /users/{id}/logout", h.guard(user.PermissionUsersWrite, h.ForceLogout))
+	mux.HandleFunc("DELETE /users/{id}", h.guard(user.PermissionUsersDelete, h.DeleteUser))
+	return mux
+}
+
+// guard lets through users whose role is granted the permission, whatever the role is called
+func (h *Handler) guard(permission string, next http.HandlerFunc) http.HandlerFunc {
+	m := h.middleware
+	return m.AuthMiddleware(m.RequirePermission(permission)(next))
+}
@@ -0,0 +1,239 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/audit"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
+)
+
+type UserRepository interface {
+	Search(ctx context.Context, f user.Filter) ([]user.User, int, error)
+	FindById(ctx context.Context, id int64) (*user.User, error)
+	UpdateRole(ctx context.Context, id int64, role string) error
+	MarkVerified(ctx context.Context, id int64) error
+	SetStatus(ctx context.Context, id int64, status string, reason *string, until *time.Time) error
+	RevokeSessions(ctx context.Context, id int64) (int, error)
+	SoftDelete(ctx context.Context, id int64, purgeAt time.Time) error
+}
+
+// TokenRepository revokes the refresh tokens of a user
+type TokenRepository interface {
+	RevokeUserRefreshTokens(ctx context.Context, userId int64) error
+}
+
+type AuditLog interface {
+	Record(ctx context.Context, e audit.Event) error
+	ListByUser(ctx context.Context, userId int64) ([]audit.Event, error)
+}
+
+// Transactor runs fn in a database transaction that the repositories pick up from ctx
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+var (
+	ErrOwnAccount     = errors.New("admins cannot do this to their own account")
+	ErrAlreadyDeleted = errors.New("account is already deleted")
+	ErrWrongStatus    = errors.New("account is not in that state")
+)
+
+// Actor is the admin performing an action, recorded in the audit log
+type Actor struct {
+	Id        int64
+	IpAddress string
+}
+
+type service struct {
+	users     UserRepository
+	tokenRepo TokenRepository
+	auditLog  AuditLog
+	tx        Transactor
+}
+
+func NewService(users UserRepository, tokenRepo TokenRepository, auditLog AuditLog, tx Transactor) *service {
+	return &service{
+		users:     users,
+		tokenRepo: tokenRepo,
+		auditLog:  auditLog,
+		tx:        tx,
+	}
+}
+
+func (s *service) ListUsers(ctx context.Context, f user.Filter) ([]user.User, int, error) {
+	return s.users.Search(ctx, f)
+}
+
+func (s *service) GetUser(ctx context.Context, id int64) (*user.User, error) {
+	return s.users.FindById(ctx, id)
+}
+
+func (s *service) ListAuditEvents(ctx context.Context, id int64) ([]audit.Event, error) {
+	if _, err := s.users.FindById(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return s.auditLog.ListByUser(ctx, id)
+}
+
+// ChangeRole gives the user another role, their sessions pick it up on the next request
+func (s *service) ChangeRole(ctx context.Context, actor Actor, id int64, role string) (*user.User, error) {
+	return s.act(ctx, actor, id, audit.ActionRoleChanged, func(ctx context.Context, u *user.User) (map[string]string, error) {
+		// an admin demoting themselves could leave nobody able to undo it
+		if u.Id == actor.Id {
+			return nil, ErrOwnAccount
+		}
+
+		if err := s.users.UpdateRole(ctx, u.Id, role); err != nil {
+			return nil, err
+		}
+
+		return map[string]string{"from": u.Role, "to": role}, nil
+	})
+}
+
+// Verify marks the user's email as verified without the emailed link
+func (s *service) Verify(ctx context.Context, actor Actor, id int64) (*user.User, error) {
+	return s.act(ctx, actor, id, audit.ActionVerified, func(ctx context.Context, u *user.User) (map[string]string, error) {
+		return nil, s.users.MarkVerified(ctx, u.Id)
+	})
+}
+
+// Suspend blocks the user from logging in, until an admin lifts it or, when given, until
+// passes, and logs them out everywhere
+func (s *service) Suspend(ctx context.Context, actor Actor, id int64, reason string, until *time.Time) (*user.User, error) {
+	return s.block(ctx, actor, id, audit.ActionSuspended, user.StatusSuspended, reason, until)
+}
+
+func (s *service) Unsuspend(ctx context.Context, actor Actor, id int64) (*user.User, error) {
+	return s.unblock(ctx, actor, id, audit.ActionUnsuspended, user.StatusSuspended)
+}
+
+// Lock is a suspension that always ends by itself, e.g. while a compromised account is looked into
+func (s *service) Lock(ctx context.Context, actor Actor, id int64, reason string, until time.Time) (*user.User, error) {
+	return s.block(ctx, actor, id, audit.ActionLocked, user.StatusLocked, reason, &until)
+}
+
+func (s *service) Unlock(ctx context.Context, actor Actor, id int64) (*user.User, error) {
+	return s.unblock(ctx, actor, id, audit.ActionUnlocked, user.StatusLocked)
+}
+
+func (s *service) block(ctx context.Context, actor Actor, id int64, action, status, reason string, until *time.Time) (*user.User, error) {
+	return s.act(ctx, actor, id, action, func(ctx context.Context, u *user.User) (map[string]string, error) {
+		if u.Id == actor.Id {
+			return nil, ErrOwnAccount
+		}
+
+		if u.DeletedAt != nil {
+			return nil, ErrAlreadyDeleted
+		}
+
+		if err := s.users.SetStatus(ctx, u.Id, status, &reason, until); err != nil {
+			return nil, err
+		}
+
+		if err := s.tokenRepo.RevokeUserRefreshTokens(ctx, u.Id); err != nil {
+			return nil, err
+		}
+
+		details := map[string]string{"reason": reason}
+		if until != nil {
+			details["until"] = until.UTC().Format(time.RFC3339)
+		}
+
+		return details, nil
+	})
+}
+
+// unblock makes the account active again, provided it is in the given state
+func (s *service) unblock(ctx context.Context, actor Actor, id int64, action, status string) (*user.User, error) {
+	return s.act(ctx, actor, id, action, func(ctx context.Context, u *user.User) (map[string]string, error) {
+		if u.Status != status {
+			return nil, ErrWrongStatus
+		}
+
+		return nil, s.users.SetStatus(ctx, u.Id, user.StatusActive, nil, nil)
+	})
+}
+
+// ForceLogout revokes every session and refresh token of the user
+func (s *service) ForceLogout(ctx context.Context, actor Actor, id int64) error {
+	_, err := s.act(ctx, actor, id, audit.ActionSessionsRevoked, func(ctx context.Context, u *user.User) (map[string]string, error) {
+		if _, err := s.users.RevokeSessions(ctx, u.Id); err != nil {
+			return nil, err
+		}
+
+		return nil, s.tokenRepo.RevokeUserRefreshTokens(ctx, u.Id)
+	})
+
+	return err
+}
+
+// DeleteUser deletes the account without a grace period, the purger removes it
+// together with its profile picture on its next run
+func (s *service) DeleteUser(ctx context.Context, actor Actor, id int64) error {
+	_, err := s.act(ctx, actor, id, audit.ActionDeleted, func(ctx context.Context, u *user.User) (map[string]string, error) {
+		if u.Id == actor.Id {
+			return nil, ErrOwnAccount
+		}
+
+		if u.DeletedAt != nil {
+			return nil, ErrAlreadyDeleted
+		}
+
+		if err := s.users.SoftDelete(ctx, u.Id, time.Now()); err != nil {
+			return nil, err
+		}
+
+		// the event outlives the user, whose id is cleared from it by the purge
+		details := map[string]string{"email": u.Email, "userId": strconv.FormatInt(u.Id, 10)}
+
+		return details, s.tokenRepo.RevokeUserRefreshTokens(ctx, u.Id)
+	})
+
+	return err
+}
+
+// act runs an admin action on the user and records it in the audit log, in one transaction.
+// fn returns the details to record with the event.
+func (s *service) act(ctx context.Context, actor Actor, id int64, action string, fn func(ctx context.Context, u *user.User) (map[string]string, error)) (*user.User, error) {
+	var updated *user.User
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		u, err := s.users.FindById(ctx, id)
+
+		if err != nil {
+			return err
+		}
+
+		details, err := fn(ctx, u)
+
+		if err != nil {
+			return err
+		}
+
+		err = s.auditLog.Record(ctx, audit.Event{
+			UserId:    u.Id,
+			ActorId:   &actor.Id,
+			Action:    action,
+			Details:   details,
+			IpAddress: actor.IpAddress,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		updated, err = s.users.FindById(ctx, id)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+)
+
+// memoryRepository is an in-memory stand-in for repository, for tests
+type memoryRepository struct {
+	mu     sync.Mutex
+	nextId int64
+	events []Event
+}
+
+func NewMemoryRepository() *memoryRepository {
+	return &memoryRepository{nextId: 1}
+}
+
+func (r *memoryRepository) Record(ctx context.Context, e Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e.Id = r.nextId
+	e.Details = maps.Clone(e.Details)
+	e.CreatedAt = time.Now()
+	r.events = append(r.events, e)
+	r.nextId++
+
+	return nil
+}
+
+func (r *memoryRepository) ListByUser(ctx context.Context, userId int64) ([]Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var events []Event
+
+	for _, e := range r.events {
+		if e.UserId == userId {
+			events = append(events, e)
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,29 @@
+package audit
+
+import "time"
+
+const (
+	ActionDataExportRequested = "data_export.requested"
+	// actions of admins on other accounts
+	ActionRoleChanged     = "admin.role_changed"
+	ActionVerified        = "admin.verified"
+	ActionSuspended       = "admin.suspended"
+	ActionUnsuspended     = "admin.unsuspended"
+	ActionLocked          = "admin.locked"
+	ActionUnlocked        = "admin.unlocked"
+	ActionSessionsRevoked = "admin.sessions_revoked"
+	ActionDeleted         = "admin.deleted"
+)
+
+// Event records something that happened to a user's account. ActorId is the user who
+// did it when that is someone else, e.g. an admin, and nil otherwise. Events are kept
+// when the user is purged, the database then clears their user_id.
+type Event struct {
+	Id        int64             `json:"id"`
+	UserId    int64             `json:"userId"`
+	ActorId   *int64            `json:"actorId,omitempty"`
+	Action    string            `json:"action"`
+	Details   map[string]string `json:"details,omitempty"`
+	IpAddress string            `json:"ipAddress,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
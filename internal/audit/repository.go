@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/txn"
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *repository {
+	return &repository{db: db}
+}
+
+// Record stores an event, joining the transaction carried by ctx if any
+func (r *repository) Record(ctx context.Context, e Event) error {
+	details, err := json.Marshal(e.Details)
+	if err != nil {
+		return err
+	}
+
+	// a nil map marshals to null, the column wants an object
+	if e.Details == nil {
+		details = []byte("{}")
+	}
+
+	query := `INSERT INTO audit_events (
+		user_id,
+		actor_id,
+		action,
+		details,
+		ip_address
+	) VALUES (
+		$1, $2, $3, $4, $5
+	)`
+
+	if _, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, e.UserId, e.ActorId, e.Action, details, e.IpAddress); err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+
+	return nil
+}
+
+// ListByUser returns every event of the user, oldest first
+func (r *repository) ListByUser(ctx context.Context, userId int64) ([]Event, error) {
+	query := `SELECT id, user_id, actor_id, action, details, ip_address, created_at
+	FROM audit_events
+	WHERE user_id = $1
+	ORDER BY created_at, id`
+
+	rows, err := txn.Conn(ctx, r.db).QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute select query: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+
+	for rows.Next() {
+		var e Event
+		var details []byte
+
+		if err := rows.Scan(&e.Id, &e.UserId, &e.ActorId, &e.Action, &details, &e.IpAddress, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(details, &e.Details); err != nil {
+			return nil, fmt.Errorf("failed to decode audit event details: %w", err)
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	attemptsKeyPrefix = "login:attempts:"
+	blockedKeyPrefix  = "login:blocked:"
+)
+
+// reserveScript checks the block and counts the attempt in one step, blocking the key
+// with a doubling delay once it is past the free attempts. It returns the remaining
+// block in milliseconds, 0 when the attempt was counted.
+var reserveScript = redis.NewScript(`
+local wait = redis.call('PTTL', KEYS[2])
+if wait > 0 then
+	return wait
+end
+
+local n = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+
+local free = tonumber(ARGV[1])
+if n > free then
+	local delay = tonumber(ARGV[2])
+	local max = tonumber(ARGV[3])
+	for i = 2, n - free do
+		if delay >= max then
+			break
+		end
+		delay = delay * 2
+	end
+	redis.call('SET', KEYS[2], 1, 'PX', math.min(delay, max))
+end
+
+return 0
+`)
+
+// releaseScript decrements the count, which may have expired in between, never below zero
+var releaseScript = redis.NewScript(`
+local n = tonumber(redis.call('GET', KEYS[1]) or '0')
+if n > 0 then
+	redis.call('DECR', KEYS[1])
+end
+
+return 0
+`)
+
+// redisAttemptStore keeps the counters in Redis, so they expire by themselves
+type redisAttemptStore struct {
+	client *redis.Client
+}
+
+func NewRedisAttemptStore(client *redis.Client) *redisAttemptStore {
+	return &redisAttemptStore{client: client}
+}
+
+func (s *redisAttemptStore) Reserve(ctx context.Context, key string, limit AttemptLimit) (time.Duration, error) {
+	keys := []string{attemptsKeyPrefix + key, blockedKeyPrefix + key}
+
+	wait, err := reserveScript.Run(ctx, s.client, keys, limit.Free, limit.BaseDelay.Milliseconds(), limit.MaxDelay.Milliseconds(), limit.Window.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve login attempt: %w", err)
+	}
+
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+func (s *redisAttemptStore) Release(ctx context.Context, key string) error {
+	if err := releaseScript.Run(ctx, s.client, []string{attemptsKeyPrefix + key}).Err(); err != nil {
+		return fmt.Errorf("failed to release login attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (s *redisAttemptStore) Reset(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, attemptsKeyPrefix+key, blockedKeyPrefix+key).Err(); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+
+	return nil
+}
@@ -1,5 +1,7 @@
 package auth
 
+import "time"
+
 type RegisterRequest struct {
 	Email    string `json:"email" validate:"email,required"`
 	Password string `json:"password" validate:"required,min=6"`
@@ -15,6 +17,50 @@ type RegisterResponse struct {
 	ProfilePic string `json:"profilePic"`
 }
 
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"email,required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+// ChangePasswordRequest authorizes the change either with the current password
+// or with a token from the email sent by GetChangePasswordEmail
+type ChangePasswordRequest struct {
+	CurrentPassword     string `json:"currentPassword" validate:"required_without=Token"`
+	Token               string `json:"token" validate:"required_without=CurrentPassword"`
+	NewPassword         string `json:"newPassword" validate:"required"`
+	LogoutOtherSessions bool   `json:"logoutOtherSessions"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail        string `json:"newEmail" validate:"email,required"`
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+}
+
+// DeleteAccountRequest re-authenticates the user before their account is deleted
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type SessionInfo struct {
+	UserId     int64     `json:"userId"`
+	Role       string    `json:"role"`
+	IsVerified bool      `json:"isVerified"`
+	IssuedAt   time.Time `json:"issuedAt,omitzero"`
+	ExpiresAt  time.Time `json:"expiresAt,omitzero"`
+	// MFA is not supported yet, it is reported so clients can rely on the field
+	MfaEnabled bool `json:"mfaEnabled"`
+}
+
+type AuthStatusResponse struct {
+	Authenticated bool              `json:"authenticated"`
+	Session       *SessionInfo      `json:"session,omitempty"`
+	User          *RegisterResponse `json:"user,omitempty"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" validate:"email,required"`
 	Password string `json:"password" validate:"required,min=6"`
@@ -6,11 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/checkimage"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/imageproc"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/response"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/session"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/types"
@@ -19,13 +24,27 @@ import (
 )
 
 type Service interface {
-	Register(context.Context, *types.UserInput, *time.Duration, *multipart.File, *multipart.FileHeader) (*user.User, *string, error)
-	Login(context.Context, *LoginRequest, time.Duration) (*user.User, string, error)
+	Register(context.Context, *types.UserInput, *time.Duration, ClientInfo, *multipart.File, *multipart.FileHeader) (*user.User, *string, error)
+	Login(context.Context, *LoginRequest, time.Duration, ClientInfo) (*user.User, string, error)
+	Refresh(context.Context, string, time.Duration, ClientInfo) (*user.User, string, error)
+	Logout(context.Context, string) error
+	ResendVerificationEmail(context.Context, int64) error
+	VerifyEmail(context.Context, string) (*user.User, error)
+	RequestPasswordReset(context.Context, string) error
+	ResetPassword(context.Context, string, string) error
+	SendPasswordChangeEmail(context.Context, int64) error
+	ChangePassword(context.Context, int64, ChangePasswordInput) (*user.User, error)
+	RequestEmailChange(context.Context, int64, string, string) error
+	ConfirmEmailChange(context.Context, string) (*user.User, error)
+	CancelEmailChange(context.Context, string) error
+	DeleteAccount(context.Context, int64, string) error
+	CurrentUser(context.Context, types.UserSession) (*user.User, error)
 }
 
 type Handler struct {
 	service               Service
 	store                 *session.Store
+	middleware            *Middleware
 	refreshCookieName     string
 	refreshCookiePath     string
 	refreshCookieExpiry   string
@@ -33,10 +52,11 @@ type Handler struct {
 	profileApiPrefix      string
 }
 
-func NewHandler(s Service, store *session.Store, refreshCookieName, refreshCookiePath, refreshCookieExpiry string, isRefreshCookieSecure bool, profileApiPrefix string) *Handler {
+func NewHandler(s Service, store *session.Store, middleware *Middleware, refreshCookieName, refreshCookiePath, refreshCookieExpiry string, isRefreshCookieSecure bool, profileApiPrefix string) *Handler {
 	return &Handler{
 		service:               s,
 		store:                 store,
+		middleware:            middleware,
 		refreshCookieName:     refreshCookieName,
 		refreshCookiePath:     refreshCookiePath,
 		refreshCookieExpiry:   refreshCookieExpiry,
@@ -53,40 +73,34 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// parse multipart-form
-	err = r.ParseMultipartForm(10 << 20) // 10 Megabytes
-	if err != nil {
-		response.HandleBadRequest(w, "File too big or invalid format")
-		return
-	}
+	var req RegisterRequest
+	var file multipart.File
+	var header *multipart.FileHeader
 
-	// create an instance of the struct
-	req := RegisterRequest{
-		Email:    r.FormValue("email"),
-		Password: r.FormValue("password"),
-		FullName: r.FormValue("fullName"),
-	}
+	// JSON clients register without a picture and upload it afterwards with PUT /api/user/profile-pic
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
 
-	// validate
-	if err := validator.New().Struct(req); err != nil {
-		response.HandleValidationErrors(w, err)
-		return
-	}
+	switch mediaType {
+	case "application/json":
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
 
-	// get file and file header
-	file, header, err := r.FormFile("profilePic")
+		if !DecodeAndValidate(w, r, &req) {
+			return
+		}
+	case "multipart/form-data":
+		var ok bool
 
-	// what type of errors does r.FormFile through?
-	if err != nil {
-		response.HandleBadRequest(w, "Profile picture is required")
-		return
-	}
+		req, file, header, ok = parseMultipartRegistration(w, r)
 
-	defer file.Close()
+		if !ok {
+			return
+		}
 
-	// check file if image
-	if err = checkimage.CheckImage(file); err != nil {
-		response.HandleBadRequest(w, "Profile picture file should be of type jpg or png")
+		if file != nil {
+			defer file.Close()
+		}
+	default:
+		response.HandleUnsupportedMediaType(w, "Content-Type must be application/json or multipart/form-data")
 		return
 	}
 
@@ -103,18 +117,27 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	userInput := types.UserInput{
 		Email:      req.Email,
 		Password:   req.Password,
-		Role:       "user",
+		Role:       user.RoleUser,
 		IsVerified: false,
 		FullName:   req.FullName,
 	}
 
 	// get created user (with refreshToken but without password & passwordHash), accessToken
-	newUser, refreshToken, err := h.service.Register(r.Context(), &userInput, &parsedRefreshCookieExpiry, &file, header)
+	newUser, refreshToken, err := h.service.Register(r.Context(), &userInput, &parsedRefreshCookieExpiry, ClientInfoFromRequest(r), &file, header)
 	if err != nil {
 		fmt.Printf("from service: %s\n", err.Error())
-		if err.Error() == "email conflict" {
+		if errors.Is(err, user.ErrEmailConflict) {
 			response.HandleConflict(w, "Email already exists")
 			return
+		} else if errors.Is(err, ErrWeakPassword) {
+			response.HandleBadRequest(w, err.Error())
+			return
+		} else if errors.Is(err, imageproc.ErrInvalidImage) {
+			response.HandleBadRequest(w, "Profile picture could not be read as an image")
+			return
+		} else if errors.Is(err, imageproc.ErrTooLarge) {
+			response.HandlePayloadTooLarge(w, "Profile picture is too large")
+			return
 		} else {
 
 			response.HandleInternalError(w, "Error while creating user")
@@ -123,12 +146,7 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// handle session
-	userSession := types.UserSession{
-		UserID: newUser.Id,
-		Role:   newUser.Role,
-	}
-
-	session.Values["user"] = userSession
+	session.Values["user"] = NewUserSession(newUser)
 	session.Save(r, w)
 
 	refreshCookieExpiryInSec := int(parsedRefreshCookieExpiry.Seconds())
@@ -136,12 +154,7 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	GenerateCookieResponse(w, h.refreshCookieName, h.refreshCookiePath, *refreshToken, refreshCookieExpiryInSec, h.isRefreshCookieSecure)
 
 	// construct profile pic url
-	protocol := "http"
-	if r.TLS != nil {
-		protocol = "https"
-	}
-
-	profilePicUrl := fmt.Sprintf("%s://%s/%s/%s", protocol, r.Host, h.profileApiPrefix, "profile-pic")
+	profilePicUrl := BuildProfilePicUrl(r, h.profileApiPrefix)
 
 	resData := RegisterResponse{
 		Id:         newUser.Id,
@@ -156,6 +169,66 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	response.CreatedOne(w, "user", resData)
 }
 
+// parseMultipartRegistration reads and validates a multipart registration.
+// The picture is optional, file is nil without one and must be closed by the caller otherwise.
+func parseMultipartRegistration(w http.ResponseWriter, r *http.Request) (RegisterRequest, multipart.File, *multipart.FileHeader, bool) {
+	// the picture plus some room for the other fields
+	r.Body = http.MaxBytesReader(w, r.Body, imageproc.MaxFileSize+1<<20)
+
+	// parse multipart-form
+	err := r.ParseMultipartForm(10 << 20) // 10 Megabytes
+	if err != nil {
+		response.HandleBadRequest(w, "File too big or invalid format")
+		return RegisterRequest{}, nil, nil, false
+	}
+
+	// create an instance of the struct
+	req := RegisterRequest{
+		Email:    r.FormValue("email"),
+		Password: r.FormValue("password"),
+		FullName: r.FormValue("fullName"),
+	}
+
+	// validate
+	if err := validator.New().Struct(req); err != nil {
+		response.HandleValidationErrors(w, err)
+		return RegisterRequest{}, nil, nil, false
+	}
+
+	// get file and file header, without one a default avatar is served
+	file, header, err := r.FormFile("profilePic")
+
+	if errors.Is(err, http.ErrMissingFile) {
+		return req, nil, nil, true
+	}
+
+	if err != nil {
+		response.HandleBadRequest(w, "Invalid profile picture upload")
+		return RegisterRequest{}, nil, nil, false
+	}
+
+	// check file if image, the client's Content-Type and file name are not trusted
+	if header.Size > imageproc.MaxFileSize {
+		file.Close()
+		response.HandlePayloadTooLarge(w, "Profile picture is too large")
+		return RegisterRequest{}, nil, nil, false
+	}
+
+	if _, err = checkimage.CheckImage(file); err != nil {
+		file.Close()
+
+		if errors.Is(err, imageproc.ErrTooLarge) {
+			response.HandlePayloadTooLarge(w, "Profile picture dimensions are too large")
+			return RegisterRequest{}, nil, nil, false
+		}
+
+		response.HandleBadRequest(w, "Profile picture should be a jpg, png, gif or webp image")
+		return RegisterRequest{}, nil, nil, false
+	}
+
+	return req, file, header, true
+}
+
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	session, err := h.store.Get(r)
 
@@ -192,25 +265,31 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, refreshToken, err := h.service.Login(r.Context(), &loginCredentials, parsedRefreshCookieExpiry)
+	user, refreshToken, err := h.service.Login(r.Context(), &loginCredentials, parsedRefreshCookieExpiry, ClientInfoFromRequest(r))
 
 	if err != nil {
-		if err.Error() == "invalid credentials" {
+		if errors.Is(err, ErrInvalidCredentials) {
 			response.HandleUnauthorized(w, err.Error())
 			return
 		}
 
+		var throttledErr *LoginThrottledError
+		if errors.As(err, &throttledErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttledErr.RetryAfter.Seconds()))))
+			response.HandleTooManyRequests(w, err.Error())
+			return
+		}
+
+		if handleAccountStatusError(w, err) {
+			return
+		}
+
 		response.HandleInternalError(w, err.Error())
 		return
 	}
 
 	// handle session
-	userSession := types.UserSession{
-		UserID: user.Id,
-		Role:   user.Role,
-	}
-
-	session.Values["user"] = userSession
+	session.Values["user"] = NewUserSession(user)
 	session.Save(r, w)
 
 	refreshCookieExpiryInSec := int(parsedRefreshCookieExpiry.Seconds())
@@ -218,12 +297,7 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	GenerateCookieResponse(w, h.refreshCookieName, h.refreshCookiePath, refreshToken, refreshCookieExpiryInSec, h.isRefreshCookieSecure)
 
 	// construct profile pic url
-	protocol := "http"
-	if r.TLS != nil {
-		protocol = "https"
-	}
-
-	profilePicUrl := fmt.Sprintf("%s://%s/%s/%s", protocol, r.Host, h.profileApiPrefix, "profile-pic")
+	profilePicUrl := BuildProfilePicUrl(r, h.profileApiPrefix)
 
 	resData := RegisterResponse{
 		Id:         user.Id,
@@ -238,17 +312,458 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	response.CreatedOne(w, "user", resData)
 }
 
-func (h *Handler) CheckAuthStatus(w http.ResponseWriter, r *http.Request) {}
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	session, err := h.store.Get(r)
+
+	if err != nil {
+		response.HandleInternalError(w, "Error while initiating session")
+		return
+	}
+
+	cookie, err := r.Cookie(h.refreshCookieName)
+
+	if err != nil || cookie.Value == "" {
+		response.HandleUnauthorized(w, "Refresh token is missing")
+		return
+	}
+
+	parsedRefreshCookieExpiry, err := time.ParseDuration(h.refreshCookieExpiry)
+
+	if err != nil {
+		response.HandleInternalError(w, "Error in parsing refresh cookie duration")
+		return
+	}
+
+	user, refreshToken, err := h.service.Refresh(r.Context(), cookie.Value, parsedRefreshCookieExpiry, ClientInfoFromRequest(r))
+
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrExpiredRefreshToken) || errors.Is(err, ErrReusedRefreshToken) {
+			// drop whatever session the caller holds along with the rejected token
+			session.Options.MaxAge = -1
+			session.Save(r, w)
+			GenerateClearCookieResponse(w, h.refreshCookieName, h.refreshCookiePath)
+			response.HandleUnauthorized(w, err.Error())
+			return
+		}
+
+		if errors.Is(err, ErrAccountSuspended) || errors.Is(err, ErrAccountLocked) || errors.Is(err, ErrAccountPendingDeletion) {
+			session.Options.MaxAge = -1
+			session.Save(r, w)
+			GenerateClearCookieResponse(w, h.refreshCookieName, h.refreshCookiePath)
+			handleAccountStatusError(w, err)
+			return
+		}
+
+		response.HandleInternalError(w, "Error while refreshing token")
+		return
+	}
+
+	// re-issue session
+	session.Values["user"] = NewUserSession(user)
+	session.Save(r, w)
+
+	refreshCookieExpiryInSec := int(parsedRefreshCookieExpiry.Seconds())
+
+	GenerateCookieResponse(w, h.refreshCookieName, h.refreshCookiePath, refreshToken, refreshCookieExpiryInSec, h.isRefreshCookieSecure)
+
+	resData := RegisterResponse{
+		Id:         user.Id,
+		Email:      user.Email,
+		Role:       user.Role,
+		IsVerified: user.IsVerified,
+		FullName:   user.FullName,
+		ProfilePic: BuildProfilePicUrl(r, h.profileApiPrefix),
+	}
+
+	response.Retrived(w, "user", resData)
+}
+
+// CheckAuthStatus tells the caller whether it is logged in. It never fails with 401
+// so a client can call it unconditionally on startup.
+func (h *Handler) CheckAuthStatus(w http.ResponseWriter, r *http.Request) {
+	session, err := h.store.Get(r)
 
-func (h *Handler) GetVerificationEmail(w http.ResponseWriter, r *http.Request) {}
+	if err != nil {
+		// an undecodable or stale cookie simply means nobody is logged in
+		response.Retrived(w, "auth status", AuthStatusResponse{Authenticated: false})
+		return
+	}
 
-func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {}
+	userSession, ok := session.Values["user"].(types.UserSession)
 
-func (h *Handler) GetChangePasswordEmail(w http.ResponseWriter, r *http.Request) {}
+	if !ok {
+		response.Retrived(w, "auth status", AuthStatusResponse{Authenticated: false})
+		return
+	}
 
-func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {}
+	currentUser, err := h.service.CurrentUser(r.Context(), userSession)
 
-func (h *Handler) ForgetPassword(w http.ResponseWriter, r *http.Request) {}
+	if err != nil {
+		if errors.Is(err, ErrSessionRevoked) {
+			response.Retrived(w, "auth status", AuthStatusResponse{Authenticated: false})
+			return
+		}
+
+		response.HandleInternalError(w, "Error retriving user from db")
+		return
+	}
+
+	sessionInfo := SessionInfo{
+		UserId:     currentUser.Id,
+		Role:       currentUser.Role,
+		IsVerified: currentUser.IsVerified,
+		IssuedAt:   userSession.IssuedAt,
+		MfaEnabled: false,
+	}
+
+	// the store resets the expiry every time the session is saved, which happens when it is issued
+	if !userSession.IssuedAt.IsZero() && session.Options != nil {
+		sessionInfo.ExpiresAt = userSession.IssuedAt.Add(time.Duration(session.Options.MaxAge) * time.Second)
+	}
+
+	resData := AuthStatusResponse{
+		Authenticated: true,
+		Session:       &sessionInfo,
+		User: &RegisterResponse{
+			Id:         currentUser.Id,
+			Email:      currentUser.Email,
+			Role:       currentUser.Role,
+			IsVerified: currentUser.IsVerified,
+			FullName:   currentUser.FullName,
+			ProfilePic: BuildProfilePicUrl(r, h.profileApiPrefix),
+		},
+	}
+
+	response.Retrived(w, "auth status", resData)
+}
+
+func (h *Handler) GetVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	u, ok := user.GetUserFromContext(r.Context())
+
+	if !ok {
+		response.HandleInternalError(w, "Error retriving user from session")
+		return
+	}
+
+	err := h.service.ResendVerificationEmail(r.Context(), u.UserID)
+
+	if err != nil {
+		var cooldownErr *CooldownError
+
+		switch {
+		case errors.Is(err, ErrAlreadyVerified):
+			response.HandleConflict(w, err.Error())
+		case errors.As(err, &cooldownErr):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cooldownErr.RetryAfter.Seconds()))))
+			response.HandleTooManyRequests(w, err.Error())
+		default:
+			response.HandleInternalError(w, "Error while sending verification email")
+		}
+		return
+	}
+
+	response.Accepted(w, "Verification email sent")
+}
+
+// VerifyEmailPage is what the mailed verification link opens
+func (h *Handler) VerifyEmailPage(w http.ResponseWriter, r *http.Request) {
+	renderLinkPage(w, r, "Verify your email address", "Verify")
+}
+
+// VerifyEmail is posted from VerifyEmailPage
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+
+	if token == "" {
+		linkError(w, r, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	verifiedUser, err := h.service.VerifyEmail(r.Context(), token)
+
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrExpiredToken) {
+			linkError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		linkError(w, r, http.StatusInternalServerError, "Error while verifying email")
+		return
+	}
+
+	// the link may be opened in the browser that is already logged in as this user
+	session, err := h.store.Get(r)
+
+	if err == nil {
+		if current, ok := session.Values["user"].(types.UserSession); ok && current.UserID == verifiedUser.Id {
+			session.Values["user"] = NewUserSession(verifiedUser)
+			session.Save(r, w)
+		}
+	}
+
+	if fromLinkPage(r) {
+		renderLinkResult(w, http.StatusOK, "Email address verified", verifiedUser.Email+" is verified, you can close this page.")
+		return
+	}
+
+	resData := RegisterResponse{
+		Id:         verifiedUser.Id,
+		Email:      verifiedUser.Email,
+		Role:       verifiedUser.Role,
+		IsVerified: verifiedUser.IsVerified,
+		FullName:   verifiedUser.FullName,
+		ProfilePic: BuildProfilePicUrl(r, h.profileApiPrefix),
+	}
+
+	response.Updated(w, "user", resData)
+}
+
+func (h *Handler) GetChangePasswordEmail(w http.ResponseWriter, r *http.Request) {
+	u, ok := user.GetUserFromContext(r.Context())
+
+	if !ok {
+		response.HandleInternalError(w, "Error retriving user from session")
+		return
+	}
+
+	err := h.service.SendPasswordChangeEmail(r.Context(), u.UserID)
+
+	if err != nil {
+		var cooldownErr *CooldownError
+
+		if errors.As(err, &cooldownErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cooldownErr.RetryAfter.Seconds()))))
+			response.HandleTooManyRequests(w, err.Error())
+			return
+		}
+
+		response.HandleInternalError(w, "Error while sending password change email")
+		return
+	}
+
+	response.Accepted(w, "Password change email sent")
+}
+
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	u, ok := user.GetUserFromContext(r.Context())
+
+	if !ok {
+		response.HandleInternalError(w, "Error retriving user from session")
+		return
+	}
+
+	var req ChangePasswordRequest
+
+	if ok := DecodeAndValidate(w, r, &req); !ok {
+		return
+	}
+
+	input := ChangePasswordInput{
+		CurrentPassword:     req.CurrentPassword,
+		Token:               req.Token,
+		NewPassword:         req.NewPassword,
+		LogoutOtherSessions: req.LogoutOtherSessions,
+	}
+
+	if cookie, err := r.Cookie(h.refreshCookieName); err == nil {
+		input.RefreshToken = cookie.Value
+	}
+
+	updatedUser, err := h.service.ChangePassword(r.Context(), u.UserID, input)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrWrongPassword):
+			response.HandleUnauthorized(w, err.Error())
+		case errors.Is(err, ErrWeakPassword), errors.Is(err, ErrSamePassword), errors.Is(err, ErrInvalidToken), errors.Is(err, ErrExpiredToken):
+			response.HandleBadRequest(w, err.Error())
+		default:
+			response.HandleInternalError(w, "Error while changing password")
+		}
+		return
+	}
+
+	// other sessions were revoked by bumping the version, keep this one alive
+	if req.LogoutOtherSessions {
+		session, err := h.store.Get(r)
+
+		if err != nil {
+			response.HandleInternalError(w, "Error while initiating session")
+			return
+		}
+
+		session.Values["user"] = NewUserSession(updatedUser)
+		session.Save(r, w)
+	}
+
+	response.Updated(w, "password", nil)
+}
+
+// ChangeEmail stages a new email address that only takes effect once confirmed from it
+func (h *Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	u, ok := user.GetUserFromContext(r.Context())
+
+	if !ok {
+		response.HandleInternalError(w, "Error retriving user from session")
+		return
+	}
+
+	var req ChangeEmailRequest
+
+	if ok := DecodeAndValidate(w, r, &req); !ok {
+		return
+	}
+
+	err := h.service.RequestEmailChange(r.Context(), u.UserID, req.NewEmail, req.CurrentPassword)
+
+	if err != nil {
+		var cooldownErr *CooldownError
+
+		switch {
+		case errors.As(err, &cooldownErr):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cooldownErr.RetryAfter.Seconds()))))
+			response.HandleTooManyRequests(w, err.Error())
+		case errors.Is(err, ErrWrongPassword):
+			response.HandleUnauthorized(w, err.Error())
+		case errors.Is(err, ErrSameEmail):
+			response.HandleBadRequest(w, err.Error())
+		case errors.Is(err, user.ErrEmailConflict):
+			response.HandleConflict(w, "Email already exists")
+		default:
+			response.HandleInternalError(w, "Error while requesting email change")
+		}
+		return
+	}
+
+	response.Accepted(w, "Confirmation email sent to the new address")
+}
+
+// ConfirmEmailChangePage is what the link mailed to the new address opens
+func (h *Handler) ConfirmEmailChangePage(w http.ResponseWriter, r *http.Request) {
+	renderLinkPage(w, r, "Confirm your new email address", "Confirm")
+}
+
+// ConfirmEmailChange is posted from ConfirmEmailChangePage
+func (h *Handler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+
+	if token == "" {
+		linkError(w, r, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	updatedUser, err := h.service.ConfirmEmailChange(r.Context(), token)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrExpiredToken):
+			linkError(w, r, http.StatusBadRequest, err.Error())
+		case errors.Is(err, user.ErrEmailConflict):
+			linkError(w, r, http.StatusConflict, "Email already exists")
+		default:
+			linkError(w, r, http.StatusInternalServerError, "Error while confirming email change")
+		}
+		return
+	}
+
+	// the session carries the verified flag, refresh it if this browser is logged in as the user
+	session, err := h.store.Get(r)
+
+	if err == nil {
+		if current, ok := session.Values["user"].(types.UserSession); ok && current.UserID == updatedUser.Id {
+			session.Values["user"] = NewUserSession(updatedUser)
+			session.Save(r, w)
+		}
+	}
+
+	if fromLinkPage(r) {
+		renderLinkResult(w, http.StatusOK, "Email address changed", "Your email address is now "+updatedUser.Email+".")
+		return
+	}
+
+	resData := RegisterResponse{
+		Id:         updatedUser.Id,
+		Email:      updatedUser.Email,
+		Role:       updatedUser.Role,
+		IsVerified: updatedUser.IsVerified,
+		FullName:   updatedUser.FullName,
+		ProfilePic: BuildProfilePicUrl(r, h.profileApiPrefix),
+	}
+
+	response.Updated(w, "user", resData)
+}
+
+// CancelEmailChangePage is what the link mailed to the old address opens
+func (h *Handler) CancelEmailChangePage(w http.ResponseWriter, r *http.Request) {
+	renderLinkPage(w, r, "Cancel the change of your email address", "Cancel the change")
+}
+
+// CancelEmailChange is posted from CancelEmailChangePage
+func (h *Handler) CancelEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+
+	if token == "" {
+		linkError(w, r, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	if err := h.service.CancelEmailChange(r.Context(), token); err != nil {
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrExpiredToken) {
+			linkError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		linkError(w, r, http.StatusInternalServerError, "Error while cancelling email change")
+		return
+	}
+
+	if fromLinkPage(r) {
+		renderLinkResult(w, http.StatusOK, "Email change cancelled", "Your email address stays as it was.")
+		return
+	}
+
+	response.NoContent(w)
+}
+
+func (h *Handler) ForgetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+
+	if ok := DecodeAndValidate(w, r, &req); !ok {
+		return
+	}
+
+	// the email is only queued in the outbox, so this is quick whether the account exists or not.
+	// A failure is logged rather than answered, or it would tell that the email exists.
+	if err := h.service.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		log.Printf("failed to process password reset request: %s", err.Error())
+	}
+
+	response.Accepted(w, "If an account exists for this email, a reset link has been sent")
+}
+
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+
+	if ok := DecodeAndValidate(w, r, &req); !ok {
+		return
+	}
+
+	err := h.service.ResetPassword(r.Context(), req.Token, req.Password)
+
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrExpiredToken) || errors.Is(err, ErrWeakPassword) {
+			response.HandleBadRequest(w, err.Error())
+			return
+		}
+
+		response.HandleInternalError(w, "Error while resetting password")
+		return
+	}
+
+	// every login of this user is revoked, including the one on this device if any
+	GenerateClearCookieResponse(w, h.refreshCookieName, h.refreshCookiePath)
+	response.Updated(w, "password", nil)
+}
 
 func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
 	// revoke session
@@ -262,7 +777,74 @@ func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
 	session.Options.MaxAge = -1
 	session.Save(r, w)
 
-	// revoke refresh token
+	// revoke refresh token of this device
+	if cookie, err := r.Cookie(h.refreshCookieName); err == nil && cookie.Value != "" {
+		if err := h.service.Logout(r.Context(), cookie.Value); err != nil {
+			response.HandleInternalError(w, "Error while revoking refresh token")
+			return
+		}
+	}
+
+	GenerateClearCookieResponse(w, h.refreshCookieName, h.refreshCookiePath)
+	response.NoContent(w)
+}
+
+// DeleteAccount schedules the account for deletion and logs this device out,
+// the other devices are logged out by the service
+func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	u, ok := user.GetUserFromContext(r.Context())
+
+	if !ok {
+		response.HandleInternalError(w, "Error retriving user from session")
+		return
+	}
+
+	var req DeleteAccountRequest
+
+	if ok := DecodeAndValidate(w, r, &req); !ok {
+		return
+	}
+
+	if err := h.service.DeleteAccount(r.Context(), u.UserID, req.Password); err != nil {
+		if errors.Is(err, ErrWrongPassword) {
+			response.HandleUnauthorized(w, err.Error())
+			return
+		}
+
+		response.HandleInternalError(w, "Error while deleting account")
+		return
+	}
+
+	if session, err := h.store.Get(r); err == nil {
+		session.Options.MaxAge = -1
+		session.Save(r, w)
+	}
+
 	GenerateClearCookieResponse(w, h.refreshCookieName, h.refreshCookiePath)
 	response.NoContent(w)
 }
+
+// Error codes telling clients why an account cannot be used
+const (
+	CodeAccountSuspended       = "account_suspended"
+	CodeAccountLocked          = "account_locked"
+	CodeAccountPendingDeletion = "account_pending_deletion"
+)
+
+// handleAccountStatusError writes the response for an error of checkAccountStatus and
+// reports whether err was one. An account pending deletion answers 401 since logging
+// in again restores it, suspended and locked ones answer 403.
+func handleAccountStatusError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrAccountSuspended):
+		response.HandleErrorWithCode(w, http.StatusForbidden, CodeAccountSuspended, err.Error())
+	case errors.Is(err, ErrAccountLocked):
+		response.HandleErrorWithCode(w, http.StatusForbidden, CodeAccountLocked, err.Error())
+	case errors.Is(err, ErrAccountPendingDeletion):
+		response.HandleErrorWithCode(w, http.StatusUnauthorized, CodeAccountPendingDeletion, err.Error())
+	default:
+		return false
+	}
+
+	return true
+}
@@ -1,7 +1,18 @@
 package auth
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/response"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/types"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
+	"github.com/go-playground/validator/v10"
 )
 
 func GenerateCookieResponse(w http.ResponseWriter, cookieName string, cookiePath string, token string, expiry int, isSecure bool) {
@@ -28,3 +39,61 @@ func GenerateClearCookieResponse(w http.ResponseWriter, cookieName string, cooki
 	}
 	http.SetCookie(w, cookie)
 }
+
+// BuildProfilePicUrl constructs the absolute url of the caller's profile picture endpoint
+func BuildProfilePicUrl(r *http.Request, profileApiPrefix string) string {
+	protocol := "http"
+	if r.TLS != nil {
+		protocol = "https"
+	}
+
+	// Constructed: http://localhost:8080/api/user/profile-pic
+	return fmt.Sprintf("%s://%s/%s/%s", protocol, r.Host, profileApiPrefix, "profile-pic")
+}
+
+// ClientInfoFromRequest collects the device details stored alongside a refresh token
+func ClientInfoFromRequest(r *http.Request) ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return ClientInfo{
+		UserAgent: r.UserAgent(),
+		IpAddress: ip,
+	}
+}
+
+// NewUserSession builds the value stored in the session cookie for a logged in user
+func NewUserSession(u *user.User) types.UserSession {
+	return types.UserSession{
+		UserID:         u.Id,
+		Role:           u.Role,
+		IsVerified:     u.IsVerified,
+		SessionVersion: u.SessionVersion,
+		IssuedAt:       time.Now(),
+	}
+}
+
+// DecodeAndValidate reads a JSON body into dst and validates it.
+// On failure the error response is already written and false is returned.
+func DecodeAndValidate(w http.ResponseWriter, r *http.Request, dst any) bool {
+	err := json.NewDecoder(r.Body).Decode(dst)
+
+	if errors.Is(err, io.EOF) {
+		response.HandleBadRequest(w, "empty body")
+		return false
+	}
+
+	if err != nil {
+		response.HandleBadRequest(w, err.Error())
+		return false
+	}
+
+	if err := validator.New().Struct(dst); err != nil {
+		response.HandleValidationErrors(w, err)
+		return false
+	}
+
+	return true
+}
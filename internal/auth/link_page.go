@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/response"
+)
+
+// linkPage asks for a click before acting on an emailed link. Mail scanners and
+// link prefetchers follow GET links on their own, so only the form's POST changes anything.
+var linkPage = template.Must(template.New("link").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">{{.Button}}</button>
+</form>
+</body>
+</html>
+`))
+
+// linkResultPage tells the browser that posted linkPage how it went
+var linkResultPage = template.Must(template.New("link-result").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`))
+
+func renderLinkPage(w http.ResponseWriter, r *http.Request, title, button string) {
+	token := r.URL.Query().Get("token")
+
+	if token == "" {
+		response.HandleBadRequest(w, "token is required")
+		return
+	}
+
+	// the token is in the url, keep it out of caches and referers
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	linkPage.Execute(w, map[string]string{
+		"Title":  title,
+		"Button": button,
+		"Token":  token,
+	})
+}
+
+// fromLinkPage reports whether a browser posted the form of linkPage, api clients get json instead
+func fromLinkPage(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func renderLinkResult(w http.ResponseWriter, statusCode int, title, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+
+	linkResultPage.Execute(w, map[string]string{
+		"Title":   title,
+		"Message": message,
+	})
+}
+
+// linkError answers a failed link action as a page for browsers and as json otherwise
+func linkError(w http.ResponseWriter, r *http.Request, statusCode int, err string) {
+	if fromLinkPage(r) {
+		renderLinkResult(w, statusCode, "Something went wrong", err)
+		return
+	}
+
+	response.WriteJSON(w, statusCode, *response.GeneralError(err))
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryAttempts struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// memoryAttemptStore is an in-memory stand-in for redisAttemptStore, for tests
+type memoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]memoryAttempts
+	blocked  map[string]time.Time
+}
+
+func NewMemoryAttemptStore() *memoryAttemptStore {
+	return &memoryAttemptStore{
+		attempts: make(map[string]memoryAttempts),
+		blocked:  make(map[string]time.Time),
+	}
+}
+
+func (s *memoryAttemptStore) Reserve(ctx context.Context, key string, limit AttemptLimit) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if wait := time.Until(s.blocked[key]); wait > 0 {
+		return wait, nil
+	}
+
+	a := s.attempts[key]
+	if time.Now().After(a.expiresAt) {
+		a.count = 0
+	}
+
+	a.count++
+	a.expiresAt = time.Now().Add(limit.Window)
+	s.attempts[key] = a
+
+	if a.count > limit.Free {
+		s.blocked[key] = time.Now().Add(limit.Backoff(a.count - limit.Free))
+	}
+
+	return 0, nil
+}
+
+func (s *memoryAttemptStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.attempts[key]; ok && a.count > 0 {
+		a.count--
+		s.attempts[key] = a
+	}
+
+	return nil
+}
+
+func (s *memoryAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	delete(s.blocked, key)
+
+	return nil
+}
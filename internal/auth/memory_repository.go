@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memoryRepository is an in-memory stand-in for repository, for tests.
+// It returns the same errors as the postgres one, e.g. sql.ErrNoRows.
+type memoryRepository struct {
+	mu            sync.Mutex
+	nextId        int64
+	refreshTokens map[string]RefreshToken // by family
+	userTokens    []UserToken
+}
+
+func NewMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		nextId:        1,
+		refreshTokens: make(map[string]RefreshToken),
+	}
+}
+
+func (r *memoryRepository) CreateRefreshToken(ctx context.Context, t RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t.Id = r.nextId
+	t.LastUsedAt = t.CreatedAt
+	r.refreshTokens[t.FamilyId] = t
+	r.nextId++
+
+	return nil
+}
+
+func (r *memoryRepository) FindRefreshTokenByFamily(ctx context.Context, family string) (*RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.refreshTokens[family]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return &t, nil
+}
+
+func (r *memoryRepository) RotateRefreshToken(ctx context.Context, family string, oldHash string, newHash string, expiry time.Time, client ClientInfo) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.refreshTokens[family]
+	if !ok || t.TokenHash != oldHash {
+		return false, nil
+	}
+
+	t.TokenHash = newHash
+	t.ExpiresAt = expiry
+	t.UserAgent = client.UserAgent
+	t.IpAddress = client.IpAddress
+	t.LastUsedAt = time.Now()
+	r.refreshTokens[family] = t
+
+	return true, nil
+}
+
+func (r *memoryRepository) RevokeRefreshTokenFamily(ctx context.Context, family string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.refreshTokens, family)
+	return nil
+}
+
+func (r *memoryRepository) RevokeUserRefreshTokens(ctx context.Context, userId int64) error {
+	return r.RevokeOtherRefreshTokens(ctx, userId, "")
+}
+
+func (r *memoryRepository) RevokeOtherRefreshTokens(ctx context.Context, userId int64, keepFamily string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for family, t := range r.refreshTokens {
+		if t.UserId == userId && family != keepFamily {
+			delete(r.refreshTokens, family)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) ListUserRefreshTokens(ctx context.Context, userId int64) ([]RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tokens []RefreshToken
+
+	for _, t := range r.refreshTokens {
+		if t.UserId == userId {
+			tokens = append(tokens, t)
+		}
+	}
+
+	slices.SortFunc(tokens, func(a, b RefreshToken) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return tokens, nil
+}
+
+func (r *memoryRepository) CreateUserToken(ctx context.Context, t UserToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t.Id = r.nextId
+	r.userTokens = append(r.userTokens, t)
+	r.nextId++
+
+	return nil
+}
+
+func (r *memoryRepository) FindLatestUserToken(ctx context.Context, userId int64, purpose string) (*UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.userTokens) - 1; i >= 0; i-- {
+		if t := r.userTokens[i]; t.UserId == userId && t.Purpose == purpose {
+			return &t, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (r *memoryRepository) ConsumeUserToken(ctx context.Context, purpose string, hash string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+
+	for i, t := range r.userTokens {
+		if t.TokenHash == hash && t.Purpose == purpose && t.UsedAt == nil && t.ExpiresAt.After(now) {
+			r.userTokens[i].UsedAt = &now
+			return t.UserId, nil
+		}
+	}
+
+	return 0, sql.ErrNoRows
+}
+
+func (r *memoryRepository) DeleteUserTokens(ctx context.Context, userId int64, purpose string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.userTokens[:0]
+	for _, t := range r.userTokens {
+		if !(t.UserId == userId && t.Purpose == purpose && t.UsedAt == nil) {
+			kept = append(kept, t)
+		}
+	}
+	r.userTokens = kept
+
+	return nil
+}
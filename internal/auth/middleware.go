@@ -2,24 +2,55 @@ package auth
 
 import (
 	"context"
+	"database/sql"
 	"net/http"
+	"slices"
 
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/response"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/session"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/types"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
 )
 
+// UserFinder loads the current state of the session's user on every request
+type UserFinder interface {
+	FindById(ctx context.Context, id int64) (*user.User, error)
+}
+
+// PermissionFinder resolves the permissions granted to a role
+type PermissionFinder interface {
+	ListRolePermissions(ctx context.Context, role string) ([]string, error)
+}
+
 type Middleware struct {
-	sessionStore *session.Store
+	sessionStore         *session.Store
+	users                UserFinder
+	permissions          PermissionFinder
+	requireVerifiedEmail bool
 }
 
-func NewMiddleware(sessionStore *session.Store) *Middleware {
+func NewMiddleware(sessionStore *session.Store, users UserFinder, permissions PermissionFinder, requireVerifiedEmail bool) *Middleware {
 	return &Middleware{
-		sessionStore: sessionStore,
+		sessionStore:         sessionStore,
+		users:                users,
+		permissions:          permissions,
+		requireVerifiedEmail: requireVerifiedEmail,
 	}
 }
 
+// AuthMiddleware lets through only requests with a valid session, and when
+// verification is required, only those of users with a verified email
 func (m *Middleware) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return m.authenticate(next, m.requireVerifiedEmail)
+}
+
+// AuthMiddlewareAllowUnverified is AuthMiddleware for the routes an unverified
+// user needs to reach in order to get verified
+func (m *Middleware) AuthMiddlewareAllowUnverified(next http.HandlerFunc) http.HandlerFunc {
+	return m.authenticate(next, false)
+}
+
+func (m *Middleware) authenticate(next http.HandlerFunc, requireVerifiedEmail bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		session, err := m.sessionStore.Get(r)
 		if err != nil {
@@ -29,15 +60,110 @@ func (m *Middleware) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		val := session.Values["user"]
 
-		user, ok := val.(types.UserSession)
+		userSession, ok := val.(types.UserSession)
 
 		if !ok {
 			response.HandleUnauthorized(w, "Unauthorized")
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "user", user) // needs type assertion later
+		u, err := m.users.FindById(r.Context(), userSession.UserID)
+
+		if err != nil {
+			if err == sql.ErrNoRows {
+				response.HandleUnauthorized(w, "Unauthorized")
+				return
+			}
+
+			response.HandleInternalError(w, "Error retriving user from db")
+			return
+		}
+
+		// a suspended, locked or deleted account loses its session, with a code saying why
+		if err := checkAccountStatus(u); err != nil {
+			session.Options.MaxAge = -1
+			session.Save(r, w)
+			handleAccountStatusError(w, err)
+			return
+		}
+
+		// sessions issued before a password reset, a "log out everywhere" or a lifted
+		// suspension are dead
+		if u.SessionVersion != userSession.SessionVersion || u.DeletedAt != nil {
+			session.Options.MaxAge = -1
+			session.Save(r, w)
+			response.HandleUnauthorized(w, "Session revoked")
+			return
+		}
+
+		// a changed role or verified flag is copied into the session instead of revoking it
+		if u.Role != userSession.Role || u.IsVerified != userSession.IsVerified {
+			userSession.Role = u.Role
+			userSession.IsVerified = u.IsVerified
+			session.Values["user"] = userSession
+			session.Save(r, w)
+		}
+
+		if requireVerifiedEmail && !u.IsVerified {
+			response.HandleForbidden(w, "Email is not verified")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "user", userSession) // needs type assertion later
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
+
+// RequireRole lets through only users holding one of the roles. It reads the session
+// that AuthMiddleware puts in the context, so it must be wrapped by it:
+//
+//	m.AuthMiddleware(m.RequireRole(user.RoleAdmin)(handler))
+func (m *Middleware) RequireRole(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			userSession, ok := user.GetUserFromContext(r.Context())
+
+			if !ok {
+				response.HandleUnauthorized(w, "Unauthorized")
+				return
+			}
+
+			if !slices.Contains(roles, userSession.Role) {
+				response.HandleForbidden(w, "Insufficient role")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
+
+// RequirePermission lets through only users whose role is granted the permission.
+// Like RequireRole it must be wrapped by AuthMiddleware.
+func (m *Middleware) RequirePermission(permission string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			userSession, ok := user.GetUserFromContext(r.Context())
+
+			if !ok {
+				response.HandleUnauthorized(w, "Unauthorized")
+				return
+			}
+
+			permissions, err := m.permissions.ListRolePermissions(r.Context(), userSession.Role)
+
+			if err != nil {
+				response.HandleInternalError(w, "Error retriving permissions from db")
+				return
+			}
+
+			if !slices.Contains(permissions, permission) {
+				response.HandleForbidden(w, "Missing permission "+permission)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package auth
+
+import "time"
+
+// RefreshToken is one device's login. The family id is fixed for the lifetime of
+// the login while the token hash changes on every rotation.
+type RefreshToken struct {
+	Id         int64
+	UserId     int64
+	FamilyId   string
+	TokenHash  string
+	UserAgent  string
+	IpAddress  string
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// ClientInfo identifies the device a refresh token is issued to
+type ClientInfo struct {
+	UserAgent string
+	IpAddress string
+}
+
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposePasswordReset     = "password_reset"
+	PurposePasswordChange    = "password_change"
+	// an email change mails a confirmation to the new address and a cancel link to the old one
+	PurposeEmailChange       = "email_change"
+	PurposeEmailChangeCancel = "email_change_cancel"
+)
+
+// UserToken is a single-use emailed token; only its hash is stored
+type UserToken struct {
+	Id        int64
+	UserId    int64
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
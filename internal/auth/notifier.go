@@ -0,0 +1,12 @@
+package auth
+
+import "context"
+
+// Notifier delivers the emails the auth flows depend on, implemented by mailer.Notifier
+type Notifier interface {
+	SendVerificationEmail(ctx context.Context, to string, fullName string, link string) error
+	SendPasswordResetEmail(ctx context.Context, to string, fullName string, link string) error
+	SendPasswordChangeEmail(ctx context.Context, to string, fullName string, link string) error
+	SendEmailChangeConfirmation(ctx context.Context, to string, fullName string, link string) error
+	SendEmailChangeNotice(ctx context.Context, to string, fullName string, newEmail string, cancelLink string) error
+}
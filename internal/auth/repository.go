@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/txn"
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *repository {
+	return &repository{db: db}
+}
+
+func (r *repository) CreateRefreshToken(ctx context.Context, t RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (
+		user_id,
+		family_id,
+		token_hash,
+		user_agent,
+		ip_address,
+		expires_at,
+		created_at,
+		last_used_at
+	) VALUES (
+		$1, $2, $3, $4, $5, $6, $7, $8
+	)`
+
+	if _, err := txn.Conn(ctx, r.db).ExecContext(
+		ctx,
+		query,
+		t.UserId,
+		t.FamilyId,
+		t.TokenHash,
+		t.UserAgent,
+		t.IpAddress,
+		t.ExpiresAt,
+		t.CreatedAt,
+		t.CreatedAt,
+	); err != nil {
+		return fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) FindRefreshTokenByFamily(ctx context.Context, family string) (*RefreshToken, error) {
+	var t RefreshToken
+
+	query := `SELECT id, user_id, family_id, token_hash, user_agent, ip_address, expires_at, created_at, last_used_at
+	FROM refresh_tokens
+	WHERE family_id = $1`
+
+	err := txn.Conn(ctx, r.db).QueryRowContext(ctx, query, family).Scan(
+		&t.Id,
+		&t.UserId,
+		&t.FamilyId,
+		&t.TokenHash,
+		&t.UserAgent,
+		&t.IpAddress,
+		&t.ExpiresAt,
+		&t.CreatedAt,
+		&t.LastUsedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// RotateRefreshToken swaps the stored hash only if it still matches oldHash,
+// so two concurrent refreshes with the same token cannot both succeed.
+func (r *repository) RotateRefreshToken(ctx context.Context, family string, oldHash string, newHash string, expiry time.Time, client ClientInfo) (bool, error) {
+	query := `UPDATE refresh_tokens
+              SET token_hash = $1, expires_at = $2, user_agent = $3, ip_address = $4, last_used_at = NOW()
+              WHERE family_id = $5 AND token_hash = $6`
+
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, newHash, expiry, client.UserAgent, client.IpAddress, family, oldHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute update query: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (r *repository) RevokeRefreshTokenFamily(ctx context.Context, family string) error {
+	query := `DELETE FROM refresh_tokens WHERE family_id = $1`
+
+	if _, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, family); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) RevokeUserRefreshTokens(ctx context.Context, userId int64) error {
+	query := `DELETE FROM refresh_tokens WHERE user_id = $1`
+
+	if _, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, userId); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeOtherRefreshTokens revokes every refresh token of the user except the given family
+func (r *repository) RevokeOtherRefreshTokens(ctx context.Context, userId int64, keepFamily string) error {
+	query := `DELETE FROM refresh_tokens WHERE user_id = $1 AND family_id <> $2`
+
+	if _, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, userId, keepFamily); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+// ListUserRefreshTokens returns the logged in devices of the user, oldest first
+func (r *repository) ListUserRefreshTokens(ctx context.Context, userId int64) ([]RefreshToken, error) {
+	query := `SELECT id, user_id, family_id, token_hash, user_agent, ip_address, expires_at, created_at, last_used_at
+	FROM refresh_tokens
+	WHERE user_id = $1
+	ORDER BY created_at`
+
+	rows, err := txn.Conn(ctx, r.db).QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute select query: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []RefreshToken
+
+	for rows.Next() {
+		var t RefreshToken
+
+		if err := rows.Scan(&t.Id, &t.UserId, &t.FamilyId, &t.TokenHash, &t.UserAgent, &t.IpAddress, &t.ExpiresAt, &t.CreatedAt, &t.LastUsedAt); err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (r *repository) CreateUserToken(ctx context.Context, t UserToken) error {
+	query := `INSERT INTO user_tokens (
+		user_id,
+		purpose,
+		token_hash,
+		expires_at,
+		created_at
+	) VALUES (
+		$1, $2, $3, $4, $5
+	)`
+
+	if _, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, t.UserId, t.Purpose, t.TokenHash, t.ExpiresAt, t.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert user token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) FindLatestUserToken(ctx context.Context, userId int64, purpose string) (*UserToken, error) {
+	var t UserToken
+
+	query := `SELECT id, user_id, purpose, token_hash, expires_at, used_at, created_at
+	FROM user_tokens
+	WHERE user_id = $1 AND purpose = $2
+	ORDER BY created_at DESC
+	LIMIT 1`
+
+	err := txn.Conn(ctx, r.db).QueryRowContext(ctx, query, userId, purpose).Scan(
+		&t.Id,
+		&t.UserId,
+		&t.Purpose,
+		&t.TokenHash,
+		&t.ExpiresAt,
+		&t.UsedAt,
+		&t.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns its owner.
+// The conditional update makes the token single-use even under concurrent requests.
+func (r *repository) ConsumeUserToken(ctx context.Context, purpose string, hash string) (int64, error) {
+	var userId int64
+
+	query := `UPDATE user_tokens
+              SET used_at = NOW()
+              WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+              RETURNING user_id`
+
+	if err := txn.Conn(ctx, r.db).QueryRowContext(ctx, query, hash, purpose).Scan(&userId); err != nil {
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// DeleteUserTokens invalidates every outstanding token of a purpose for the user
+func (r *repository) DeleteUserTokens(ctx context.Context, userId int64, purpose string) error {
+	query := `DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+
+	if _, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, userId, purpose); err != nil {
+		return fmt.Errorf("failed to delete user tokens: %w", err)
+	}
+
+	return nil
+}
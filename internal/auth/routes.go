@@ -7,5 +7,29 @@ func (h Handler) RegisterRoutes() http.Handler {
 	mux.HandleFunc("POST /register", h.Register)
 	mux.HandleFunc("POST /login", h.Login)
 	mux.HandleFunc("POST /logout", h.Logout)
+	mux.HandleFunc("POST /refresh", h.Refresh)
+	mux.HandleFunc("GET /status", h.CheckAuthStatus)
+	mux.HandleFunc("POST /verification-email", h.middleware.AuthMiddlewareAllowUnverified(h.GetVerificationEmail))
+	// like the email change links below, the mailed link only opens a page
+	mux.HandleFunc("GET /verify-email", h.VerifyEmailPage)
+	mux.HandleFunc("POST /verify-email", h.VerifyEmail)
+	mux.HandleFunc("POST /password/forgot", h.ForgetPassword)
+	mux.HandleFunc("POST /password/reset", h.ResetPassword)
+	mux.HandleFunc("POST /password/change/email", h.middleware.AuthMiddleware(h.GetChangePasswordEmail))
+	mux.HandleFunc("POST /password/change", h.middleware.AuthMiddleware(h.ChangePassword))
+	// unverified users may need to fix a mistyped address
+	mux.HandleFunc("POST /email/change", h.middleware.AuthMiddlewareAllowUnverified(h.ChangeEmail))
+	// the mailed links open a page whose form posts back to the same url
+	mux.HandleFunc("GET /email/change/confirm", h.ConfirmEmailChangePage)
+	mux.HandleFunc("POST /email/change/confirm", h.ConfirmEmailChange)
+	mux.HandleFunc("GET /email/change/cancel", h.CancelEmailChangePage)
+	mux.HandleFunc("POST /email/change/cancel", h.CancelEmailChange)
 	return mux
 }
+
+// RegisterAccountRoutes adds the account routes that live under the user api
+// but need the session and refresh cookie handling of this package
+func (h Handler) RegisterAccountRoutes(mux *http.ServeMux, prefix string) {
+	// unverified users may delete their account as well
+	mux.HandleFunc("DELETE "+prefix+"/account", h.middleware.AuthMiddlewareAllowUnverified(h.DeleteAccount))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/base64"
 	"encoding/hex"
@@ -11,9 +12,13 @@ import (
 	"fmt"
 	"io"
 	"mime/multipart"
-	"path/filepath"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/signedtoken"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/types"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
 	"golang.org/x/crypto/bcrypt"
@@ -22,43 +27,129 @@ import (
 type Repository interface {
 	Create(ctx context.Context, u user.User) error
 	FindByEmail(ctx context.Context, email string) (*user.User, error)
-	SaveRefreshToken(ctx context.Context, email string, hash string, expiry time.Time) error
+	FindById(ctx context.Context, id int64) (*user.User, error)
+	MarkVerified(ctx context.Context, id int64) error
+	UpdatePassword(ctx context.Context, id int64, hash string) error
+	RevokeSessions(ctx context.Context, id int64) (int, error)
+	SetPendingEmail(ctx context.Context, id int64, email string) error
+	ConfirmEmailChange(ctx context.Context, id int64) error
+	ClearPendingEmail(ctx context.Context, id int64) error
+	SoftDelete(ctx context.Context, id int64, purgeAt time.Time) error
+	RestoreAccount(ctx context.Context, id int64) error
+}
+
+// TokenRepository persists one refresh token per logged in device
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, t RefreshToken) error
+	FindRefreshTokenByFamily(ctx context.Context, family string) (*RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, family string, oldHash string, newHash string, expiry time.Time, client ClientInfo) (bool, error)
+	RevokeRefreshTokenFamily(ctx context.Context, family string) error
+	RevokeUserRefreshTokens(ctx context.Context, userId int64) error
+	RevokeOtherRefreshTokens(ctx context.Context, userId int64, keepFamily string) error
+	CreateUserToken(ctx context.Context, t UserToken) error
+	FindLatestUserToken(ctx context.Context, userId int64, purpose string) (*UserToken, error)
+	ConsumeUserToken(ctx context.Context, purpose string, hash string) (int64, error)
+	DeleteUserTokens(ctx context.Context, userId int64, purpose string) error
+}
+
+var (
+	ErrInvalidRefreshToken    = errors.New("invalid refresh token")
+	ErrExpiredRefreshToken    = errors.New("refresh token expired")
+	ErrReusedRefreshToken     = errors.New("refresh token reused")
+	ErrInvalidToken           = errors.New("invalid or already used token")
+	ErrExpiredToken           = errors.New("token expired")
+	ErrAlreadyVerified        = errors.New("email already verified")
+	ErrWrongPassword          = errors.New("current password is incorrect")
+	ErrSamePassword           = errors.New("new password must differ from the current one")
+	ErrWeakPassword           = errors.New("password does not meet the policy")
+	ErrSessionRevoked         = errors.New("session revoked")
+	ErrSameEmail              = errors.New("new email must differ from the current one")
+	ErrInvalidCredentials     = errors.New("invalid credentials")
+	ErrAccountSuspended       = errors.New("account suspended")
+	ErrAccountLocked          = errors.New("account locked")
+	ErrAccountPendingDeletion = errors.New("account pending deletion")
+)
+
+// CooldownError is returned when an email is requested again too soon
+type CooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return "please wait before requesting another email"
+}
+
+// TokenOptions configures the single-use tokens sent out by email
+type TokenOptions struct {
+	VerifyEmailUrl         string
+	VerificationExpiry     time.Duration
+	VerificationCooldown   time.Duration
+	ResetPasswordUrl       string
+	ResetPasswordExpiry    time.Duration
+	ResetPasswordCooldown  time.Duration
+	ChangePasswordUrl      string
+	ChangePasswordExpiry   time.Duration
+	ChangePasswordCooldown time.Duration
+	ConfirmEmailChangeUrl  string
+	CancelEmailChangeUrl   string
+	ChangeEmailExpiry      time.Duration
+	ChangeEmailCooldown    time.Duration
+}
+
+// ChangePasswordInput carries an authenticated password change
+type ChangePasswordInput struct {
+	CurrentPassword     string
+	Token               string
+	NewPassword         string
+	LogoutOtherSessions bool
+	// RefreshToken of the calling device, kept alive when other sessions are logged out
+	RefreshToken string
+}
+
+// Transactor runs fn in a database transaction that the repositories pick up from ctx
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 type FileStore interface {
 	Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error
 
 	Delete(ctx context.Context, objectName string) error
-
-	// (optional) PresignedURL generates a temporary public link
-	// PresignedURL(ctx context.Context, objectName string) (string, error)
 }
 
 type service struct {
-	profilePicPath string
-	repo           Repository
-	fileStore      FileStore
+	profilePicPath      string
+	repo                Repository
+	tokenRepo           TokenRepository
+	fileStore           FileStore
+	tx                  Transactor
+	notifier            Notifier
+	signer              *signedtoken.Signer
+	tokenOpts           TokenOptions
+	deletionGracePeriod time.Duration
+	loginThrottle       *LoginThrottle
 }
 
-func NewService(fs FileStore, repo Repository, profilePicPath string) *service {
+func NewService(fs FileStore, repo Repository, tokenRepo TokenRepository, tx Transactor, notifier Notifier, signer *signedtoken.Signer, tokenOpts TokenOptions, profilePicPath string, deletionGracePeriod time.Duration, loginThrottle *LoginThrottle) *service {
 	return &service{
-		fileStore:      fs,
-		repo:           repo,
-		profilePicPath: profilePicPath,
+		fileStore:           fs,
+		repo:                repo,
+		tokenRepo:           tokenRepo,
+		tx:                  tx,
+		notifier:            notifier,
+		signer:              signer,
+		tokenOpts:           tokenOpts,
+		profilePicPath:      profilePicPath,
+		deletionGracePeriod: deletionGracePeriod,
+		loginThrottle:       loginThrottle,
 	}
 }
 
-func (s *service) upload(ctx context.Context, f *multipart.File, h *multipart.FileHeader) (string, error) {
-	var profilePicName string
-
-	// Generate unique object name: "timestamp-filename.jpg"
-	ext := filepath.Ext(h.Filename)
-	profilePicName = fmt.Sprintf("%s/%d%s", s.profilePicPath, time.Now().UnixNano(), ext)
-
-	// use context so if the user cancels the request, the upload cancels too.
-	err := s.fileStore.Upload(ctx, profilePicName, *f, h.Size, h.Header.Get("Content-Type"))
-
-	return profilePicName, err
+// discardProfilePic deletes a picture uploaded for a registration that failed
+func (s *service) discardProfilePic(ctx context.Context, imagepath string) {
+	if imagepath != "" {
+		user.DeleteProfilePic(ctx, s.fileStore, imagepath)
+	}
 }
 
 func generateRefreshToken() (string, error) {
@@ -71,6 +162,149 @@ func generateRefreshToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
+// newRefreshToken returns a "<family>.<secret>" token. The family survives rotation,
+// which lets a replayed (already rotated) token be traced back and revoked.
+func newRefreshToken(family string) (string, error) {
+	secret, err := generateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	return family + "." + secret, nil
+}
+
+func newRefreshTokenFamily() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func parseRefreshTokenFamily(token string) (string, bool) {
+	family, secret, found := strings.Cut(token, ".")
+	if !found || family == "" || secret == "" {
+		return "", false
+	}
+
+	return family, true
+}
+
+// issueRefreshToken starts a new token family for a freshly logged in device
+func (s *service) issueRefreshToken(ctx context.Context, userId int64, expiry time.Duration, client ClientInfo) (string, error) {
+	family, err := newRefreshTokenFamily()
+
+	if err != nil {
+		return "", err
+	}
+
+	token, err := newRefreshToken(family)
+
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	err = s.tokenRepo.CreateRefreshToken(ctx, RefreshToken{
+		UserId:    userId,
+		FamilyId:  family,
+		TokenHash: HashToken(token),
+		UserAgent: client.UserAgent,
+		IpAddress: client.IpAddress,
+		ExpiresAt: now.Add(expiry),
+		CreatedAt: now,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// issueUserToken signs a new emailed token and stores its hash, invalidating
+// any earlier token of the same purpose
+func (s *service) issueUserToken(ctx context.Context, userId int64, purpose string, ttl time.Duration) (string, error) {
+	token, expiresAt, err := s.signer.Sign(purpose, userId, ttl)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.tokenRepo.DeleteUserTokens(ctx, userId, purpose); err != nil {
+		return "", err
+	}
+
+	err = s.tokenRepo.CreateUserToken(ctx, UserToken{
+		UserId:    userId,
+		Purpose:   purpose,
+		TokenHash: HashToken(token),
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeUserToken checks the signature of an emailed token and burns it
+func (s *service) consumeUserToken(ctx context.Context, token string, purpose string) (int64, error) {
+	claims, err := s.signer.Verify(token, purpose)
+
+	if err != nil {
+		if errors.Is(err, signedtoken.ErrExpired) {
+			return 0, ErrExpiredToken
+		}
+
+		return 0, ErrInvalidToken
+	}
+
+	userId, err := s.tokenRepo.ConsumeUserToken(ctx, purpose, HashToken(token))
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInvalidToken
+		}
+
+		return 0, err
+	}
+
+	if userId != claims.Subject {
+		return 0, ErrInvalidToken
+	}
+
+	return userId, nil
+}
+
+// checkCooldown rejects a new emailed token if the previous one was issued too recently
+func (s *service) checkCooldown(ctx context.Context, userId int64, purpose string, cooldown time.Duration) error {
+	latest, err := s.tokenRepo.FindLatestUserToken(ctx, userId, purpose)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+
+		return err
+	}
+
+	if wait := time.Until(latest.CreatedAt.Add(cooldown)); wait > 0 {
+		return &CooldownError{RetryAfter: wait}
+	}
+
+	return nil
+}
+
+func buildTokenLink(baseUrl string, token string) string {
+	return baseUrl + "?token=" + url.QueryEscape(token)
+}
+
 // HashToken takes a plain token string and returns the SHA-256 hash
 func HashToken(token string) string {
 	hash := sha256.New()
@@ -88,12 +322,52 @@ func HashPassword(password string) (string, error) {
 	return string(bytes), err
 }
 
+// password policy
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores anything past 72 bytes
+)
+
+// CheckPasswordPolicy validates a new password; existing passwords are never re-checked on login
+func CheckPasswordPolicy(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return fmt.Errorf("%w: must be between %d and %d characters", ErrWeakPassword, minPasswordLength, maxPasswordLength)
+	}
+
+	var hasLetter, hasDigit bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLetter(c):
+			hasLetter = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		}
+	}
+
+	if !hasLetter || !hasDigit {
+		return fmt.Errorf("%w: must contain at least one letter and one digit", ErrWeakPassword)
+	}
+
+	return nil
+}
+
 func CheckPassword(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
 
-func (s *service) Register(rCtx context.Context, u *types.UserInput, parsedRefreshCookieExpiry *time.Duration, file *multipart.File, fileHeader *multipart.FileHeader) (*user.User, *string, error) {
+// dummyPasswordHash is checked against when an email has no account, so that login
+// takes as long as with a wrong password and does not give away which emails exist
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("dummy-password-for-timing")
+	return hash
+})
+
+func (s *service) Register(rCtx context.Context, u *types.UserInput, parsedRefreshCookieExpiry *time.Duration, client ClientInfo, file *multipart.File, fileHeader *multipart.FileHeader) (*user.User, *string, error) {
+	if err := CheckPasswordPolicy(u.Password); err != nil {
+		return nil, nil, err
+	}
+
 	// check email conflict
 	userExists, err := s.repo.FindByEmail(rCtx, u.Email)
 	if err != nil {
@@ -103,89 +377,606 @@ func (s *service) Register(rCtx context.Context, u *types.UserInput, parsedRefre
 			return nil, nil, err
 		}
 	} else if userExists != nil {
-		return nil, nil, errors.New("email conflict")
+		return nil, nil, user.ErrEmailConflict
 	}
 
 	// upload image --> get image name (path-name/image-name.jpg)
-	imagepath, err := s.upload(rCtx, file, fileHeader)
+	// without one the user gets a generated default avatar
+	var imagepath string
 
-	if err != nil {
-		return nil, nil, err
-	}
+	if file != nil && *file != nil {
+		imagepath, err = user.UploadProfilePic(rCtx, s.fileStore, s.profilePicPath, *file)
 
-	// refresh token
-	token, err := generateRefreshToken()
-
-	if err != nil {
-		return nil, nil, err
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-	hashedToken := HashToken(token)
+
 	hashedPassword, err := HashPassword(u.Password)
 
 	if err != nil {
+		s.discardProfilePic(rCtx, imagepath)
 		return nil, nil, err
 	}
 
 	now := time.Now()
-	refreshTokenExpiry := now.Add(*parsedRefreshCookieExpiry)
-
-	// insert user to db --> get user id
-	err = s.repo.Create(rCtx, user.User{
-		Email:              u.Email,
-		Role:               "user",
-		PasswordHash:       hashedPassword,
-		RefreshTokenHash:   hashedToken,
-		RefreshTokenExpiry: refreshTokenExpiry,
-		FullName:           u.FullName,
-		ProfilePicName:     imagepath,
-		UpdatedAt:          now,
+
+	var createdUser *user.User
+	var token string
+
+	// the user, its first refresh token and the queued verification email are committed together
+	err = s.tx.WithinTx(rCtx, func(ctx context.Context) error {
+		// insert user to db --> get user id
+		err := s.repo.Create(ctx, user.User{
+			Email:          u.Email,
+			Role:           user.RoleUser,
+			PasswordHash:   hashedPassword,
+			FullName:       u.FullName,
+			ProfilePicName: imagepath,
+			UpdatedAt:      now,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		// get the user row from the db
+		createdUser, err = s.repo.FindByEmail(ctx, u.Email)
+
+		if err != nil {
+			return err
+		}
+
+		// refresh token
+		token, err = s.issueRefreshToken(ctx, createdUser.Id, *parsedRefreshCookieExpiry, client)
+
+		if err != nil {
+			return err
+		}
+
+		return s.sendVerificationEmail(ctx, createdUser)
 	})
 
 	if err != nil {
+		// nothing references the picture once the transaction rolled back
+		s.discardProfilePic(rCtx, imagepath)
 		return nil, nil, err
 	}
 
-	// get the user row from the db
-	createdUser, err := s.repo.FindByEmail(rCtx, u.Email)
+	return createdUser, &token, nil
+}
+
+// Login checks the credentials, failing with ErrInvalidCredentials whether the email has no
+// account or the password is wrong, and with a *LoginThrottledError after too many failures
+func (s *service) Login(rCtx context.Context, u *LoginRequest, parsedRefreshCookieExpiry time.Duration, client ClientInfo) (*user.User, string, error) {
+	if err := s.loginThrottle.Reserve(rCtx, u.Email, client.IpAddress); err != nil {
+		return nil, "", err
+	}
+
+	user, err := s.repo.FindByEmail(rCtx, u.Email)
+
+	if err != nil && err != sql.ErrNoRows {
+		return nil, "", err
+	}
+
+	if err == sql.ErrNoRows {
+		CheckPassword(u.Password, dummyPasswordHash())
+		return nil, "", ErrInvalidCredentials
+	}
+
+	if isValid := CheckPassword(u.Password, user.PasswordHash); isValid != true {
+		return nil, "", ErrInvalidCredentials
+	}
+
+	if err := s.loginThrottle.Succeed(rCtx, u.Email, client.IpAddress); err != nil {
+		return nil, "", err
+	}
+
+	err = checkAccountStatus(user)
+
+	if err != nil && !errors.Is(err, ErrAccountPendingDeletion) {
+		return nil, "", err
+	}
+
+	// logging back in during the grace period cancels a pending deletion
+	if errors.Is(err, ErrAccountPendingDeletion) {
+		user, err = s.restoreAccount(rCtx, user.Id)
+
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	// refresh token
+	token, err := s.issueRefreshToken(rCtx, user.Id, parsedRefreshCookieExpiry, client)
 
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 
-	return createdUser, &token, nil
+	return user, token, nil
 }
 
-func (s *service) Login(rCtx context.Context, u *LoginRequest, parsedRefreshCookieExpiry time.Duration) (*user.User, string, error) {
-	user, err := s.repo.FindByEmail(rCtx, u.Email)
+// Refresh validates a refresh token and rotates it. Presenting a token that was
+// already rotated is treated as theft and revokes the whole token family.
+func (s *service) Refresh(rCtx context.Context, token string, parsedRefreshCookieExpiry time.Duration, client ClientInfo) (*user.User, string, error) {
+	family, ok := parseRefreshTokenFamily(token)
+	if !ok {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	stored, err := s.tokenRepo.FindRefreshTokenByFamily(rCtx, family)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, "", errors.New("no account")
+			return nil, "", ErrInvalidRefreshToken
 		}
 
 		return nil, "", err
 	}
 
-	if isValid := CheckPassword(u.Password, user.PasswordHash); isValid != true {
-		return nil, "", errors.New("invalid password")
+	hashedToken := HashToken(token)
+
+	if subtle.ConstantTimeCompare([]byte(hashedToken), []byte(stored.TokenHash)) != 1 {
+		// the family is live but this token is not its latest one
+		if err := s.tokenRepo.RevokeRefreshTokenFamily(rCtx, family); err != nil {
+			return nil, "", err
+		}
+
+		return nil, "", ErrReusedRefreshToken
 	}
 
-	// refresh token
-	token, err := generateRefreshToken()
+	if time.Now().After(stored.ExpiresAt) {
+		if err := s.tokenRepo.RevokeRefreshTokenFamily(rCtx, family); err != nil {
+			return nil, "", err
+		}
+
+		return nil, "", ErrExpiredRefreshToken
+	}
+
+	newToken, err := newRefreshToken(family)
 
 	if err != nil {
 		return nil, "", err
 	}
-	hashedToken := HashToken(token)
 
-	now := time.Now()
-	refreshTokenExpiry := now.Add(parsedRefreshCookieExpiry)
+	rotated, err := s.tokenRepo.RotateRefreshToken(rCtx, family, hashedToken, HashToken(newToken), time.Now().Add(parsedRefreshCookieExpiry), client)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !rotated {
+		// a concurrent request rotated this token first
+		if err := s.tokenRepo.RevokeRefreshTokenFamily(rCtx, family); err != nil {
+			return nil, "", err
+		}
+
+		return nil, "", ErrReusedRefreshToken
+	}
 
-	err = s.repo.SaveRefreshToken(rCtx, u.Email, hashedToken, refreshTokenExpiry)
+	user, err := s.repo.FindById(rCtx, stored.UserId)
 
 	if err != nil {
 		return nil, "", err
 	}
 
-	return user, token, nil
+	if err := checkAccountStatus(user); err != nil {
+		if err := s.tokenRepo.RevokeRefreshTokenFamily(rCtx, family); err != nil {
+			return nil, "", err
+		}
+
+		return nil, "", err
+	}
+
+	return user, newToken, nil
+}
+
+// Logout revokes the refresh token family of the calling device only
+func (s *service) Logout(rCtx context.Context, token string) error {
+	family, ok := parseRefreshTokenFamily(token)
+	if !ok {
+		return nil
+	}
+
+	return s.tokenRepo.RevokeRefreshTokenFamily(rCtx, family)
+}
+
+// sendTokenEmail issues an emailed token and queues the email carrying its link in one transaction
+func (s *service) sendTokenEmail(ctx context.Context, u *user.User, purpose string, ttl time.Duration, linkBase string, send func(ctx context.Context, to string, fullName string, link string) error) error {
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		token, err := s.issueUserToken(ctx, u.Id, purpose, ttl)
+
+		if err != nil {
+			return err
+		}
+
+		return send(ctx, u.Email, u.FullName, buildTokenLink(linkBase, token))
+	})
+}
+
+func (s *service) sendVerificationEmail(ctx context.Context, u *user.User) error {
+	return s.sendTokenEmail(ctx, u, PurposeEmailVerification, s.tokenOpts.VerificationExpiry, s.tokenOpts.VerifyEmailUrl, s.notifier.SendVerificationEmail)
+}
+
+// ResendVerificationEmail issues a fresh verification link, at most once per cooldown
+func (s *service) ResendVerificationEmail(rCtx context.Context, userId int64) error {
+	u, err := s.repo.FindById(rCtx, userId)
+
+	if err != nil {
+		return err
+	}
+
+	if u.IsVerified {
+		return ErrAlreadyVerified
+	}
+
+	if err := s.checkCooldown(rCtx, u.Id, PurposeEmailVerification, s.tokenOpts.VerificationCooldown); err != nil {
+		return err
+	}
+
+	return s.sendVerificationEmail(rCtx, u)
+}
+
+// VerifyEmail burns a verification token and flags its owner as verified
+func (s *service) VerifyEmail(rCtx context.Context, token string) (*user.User, error) {
+	var verifiedUser *user.User
+
+	err := s.tx.WithinTx(rCtx, func(ctx context.Context) error {
+		userId, err := s.consumeUserToken(ctx, token, PurposeEmailVerification)
+
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.MarkVerified(ctx, userId); err != nil {
+			return err
+		}
+
+		verifiedUser, err = s.repo.FindById(ctx, userId)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return verifiedUser, nil
+}
+
+// RequestPasswordReset emails a reset link if the account exists. The caller must not
+// reveal the outcome, so unknown emails and cooldowns end silently.
+func (s *service) RequestPasswordReset(rCtx context.Context, email string) error {
+	u, err := s.repo.FindByEmail(rCtx, email)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+
+		return err
+	}
+
+	if err := s.checkCooldown(rCtx, u.Id, PurposePasswordReset, s.tokenOpts.ResetPasswordCooldown); err != nil {
+		var cooldownErr *CooldownError
+		if errors.As(err, &cooldownErr) {
+			return nil
+		}
+
+		return err
+	}
+
+	return s.sendTokenEmail(rCtx, u, PurposePasswordReset, s.tokenOpts.ResetPasswordExpiry, s.tokenOpts.ResetPasswordUrl, s.notifier.SendPasswordResetEmail)
+}
+
+// ResetPassword burns a reset token, sets the new password and logs the user out everywhere
+func (s *service) ResetPassword(rCtx context.Context, token string, password string) error {
+	if err := CheckPasswordPolicy(password); err != nil {
+		return err
+	}
+
+	hashedPassword, err := HashPassword(password)
+
+	if err != nil {
+		return err
+	}
+
+	return s.tx.WithinTx(rCtx, func(ctx context.Context) error {
+		userId, err := s.consumeUserToken(ctx, token, PurposePasswordReset)
+
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.UpdatePassword(ctx, userId, hashedPassword); err != nil {
+			return err
+		}
+
+		return s.revokeAllLogins(ctx, userId)
+	})
+}
+
+// revokeAllLogins kills every session and refresh token of the user
+func (s *service) revokeAllLogins(ctx context.Context, userId int64) error {
+	if _, err := s.repo.RevokeSessions(ctx, userId); err != nil {
+		return err
+	}
+
+	return s.tokenRepo.RevokeUserRefreshTokens(ctx, userId)
+}
+
+// SendPasswordChangeEmail emails a link that authorizes a password change without the current password
+func (s *service) SendPasswordChangeEmail(rCtx context.Context, userId int64) error {
+	u, err := s.repo.FindById(rCtx, userId)
+
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkCooldown(rCtx, u.Id, PurposePasswordChange, s.tokenOpts.ChangePasswordCooldown); err != nil {
+		return err
+	}
+
+	return s.sendTokenEmail(rCtx, u, PurposePasswordChange, s.tokenOpts.ChangePasswordExpiry, s.tokenOpts.ChangePasswordUrl, s.notifier.SendPasswordChangeEmail)
+}
+
+// ChangePassword re-authenticates the user with either the current password or an emailed token
+// and stores the new password. It returns the updated user so the caller can re-issue its session.
+func (s *service) ChangePassword(rCtx context.Context, userId int64, in ChangePasswordInput) (*user.User, error) {
+	if err := CheckPasswordPolicy(in.NewPassword); err != nil {
+		return nil, err
+	}
+
+	u, err := s.repo.FindById(rCtx, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if in.CurrentPassword != "" && !CheckPassword(in.CurrentPassword, u.PasswordHash) {
+		return nil, ErrWrongPassword
+	}
+
+	if CheckPassword(in.NewPassword, u.PasswordHash) {
+		return nil, ErrSamePassword
+	}
+
+	hashedPassword, err := HashPassword(in.NewPassword)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var updatedUser *user.User
+
+	err = s.tx.WithinTx(rCtx, func(ctx context.Context) error {
+		if in.CurrentPassword == "" {
+			tokenUserId, err := s.consumeUserToken(ctx, in.Token, PurposePasswordChange)
+
+			if err != nil {
+				return err
+			}
+
+			if tokenUserId != u.Id {
+				return ErrInvalidToken
+			}
+		}
+
+		if err := s.repo.UpdatePassword(ctx, u.Id, hashedPassword); err != nil {
+			return err
+		}
+
+		if in.LogoutOtherSessions {
+			if _, err := s.repo.RevokeSessions(ctx, u.Id); err != nil {
+				return err
+			}
+
+			family, _ := parseRefreshTokenFamily(in.RefreshToken)
+
+			if err := s.tokenRepo.RevokeOtherRefreshTokens(ctx, u.Id, family); err != nil {
+				return err
+			}
+		}
+
+		updatedUser, err = s.repo.FindById(ctx, u.Id)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return updatedUser, nil
+}
+
+// RequestEmailChange stages newEmail after re-checking the password. The new address gets
+// a confirmation link and the current one a notice with a link to cancel the change.
+func (s *service) RequestEmailChange(rCtx context.Context, userId int64, newEmail string, currentPassword string) error {
+	u, err := s.repo.FindById(rCtx, userId)
+
+	if err != nil {
+		return err
+	}
+
+	if !CheckPassword(currentPassword, u.PasswordHash) {
+		return ErrWrongPassword
+	}
+
+	if strings.EqualFold(newEmail, u.Email) {
+		return ErrSameEmail
+	}
+
+	if _, err := s.repo.FindByEmail(rCtx, newEmail); err == nil {
+		return user.ErrEmailConflict
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	if err := s.checkCooldown(rCtx, u.Id, PurposeEmailChange, s.tokenOpts.ChangeEmailCooldown); err != nil {
+		return err
+	}
+
+	return s.tx.WithinTx(rCtx, func(ctx context.Context) error {
+		if err := s.repo.SetPendingEmail(ctx, u.Id, newEmail); err != nil {
+			return err
+		}
+
+		// issuing replaces the links of an earlier, unconfirmed change
+		confirmToken, err := s.issueUserToken(ctx, u.Id, PurposeEmailChange, s.tokenOpts.ChangeEmailExpiry)
+
+		if err != nil {
+			return err
+		}
+
+		cancelToken, err := s.issueUserToken(ctx, u.Id, PurposeEmailChangeCancel, s.tokenOpts.ChangeEmailExpiry)
+
+		if err != nil {
+			return err
+		}
+
+		if err := s.notifier.SendEmailChangeConfirmation(ctx, newEmail, u.FullName, buildTokenLink(s.tokenOpts.ConfirmEmailChangeUrl, confirmToken)); err != nil {
+			return err
+		}
+
+		return s.notifier.SendEmailChangeNotice(ctx, u.Email, u.FullName, newEmail, buildTokenLink(s.tokenOpts.CancelEmailChangeUrl, cancelToken))
+	})
+}
+
+// ConfirmEmailChange burns a confirmation token and switches the user to the pending email.
+// Links mailed to the old address are of no use afterwards and are invalidated.
+func (s *service) ConfirmEmailChange(rCtx context.Context, token string) (*user.User, error) {
+	var updatedUser *user.User
+
+	err := s.tx.WithinTx(rCtx, func(ctx context.Context) error {
+		userId, err := s.consumeUserToken(ctx, token, PurposeEmailChange)
+
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.ConfirmEmailChange(ctx, userId); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidToken
+			}
+
+			return err
+		}
+
+		for _, purpose := range []string{PurposeEmailChangeCancel, PurposeEmailVerification, PurposePasswordReset} {
+			if err := s.tokenRepo.DeleteUserTokens(ctx, userId, purpose); err != nil {
+				return err
+			}
+		}
+
+		updatedUser, err = s.repo.FindById(ctx, userId)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return updatedUser, nil
+}
+
+// CancelEmailChange burns a cancel token from the notice sent to the old address
+// and drops the pending email together with its confirmation link
+func (s *service) CancelEmailChange(rCtx context.Context, token string) error {
+	return s.tx.WithinTx(rCtx, func(ctx context.Context) error {
+		userId, err := s.consumeUserToken(ctx, token, PurposeEmailChangeCancel)
+
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.ClearPendingEmail(ctx, userId); err != nil {
+			return err
+		}
+
+		return s.tokenRepo.DeleteUserTokens(ctx, userId, PurposeEmailChange)
+	})
+}
+
+// DeleteAccount re-checks the password, then soft-deletes the account and logs it out
+// everywhere. The row and the profile picture are purged once the grace period is over.
+func (s *service) DeleteAccount(rCtx context.Context, userId int64, password string) error {
+	u, err := s.repo.FindById(rCtx, userId)
+
+	if err != nil {
+		return err
+	}
+
+	if !CheckPassword(password, u.PasswordHash) {
+		return ErrWrongPassword
+	}
+
+	return s.tx.WithinTx(rCtx, func(ctx context.Context) error {
+		// soft-deleting bumps the session version as well
+		if err := s.repo.SoftDelete(ctx, u.Id, time.Now().Add(s.deletionGracePeriod)); err != nil {
+			return err
+		}
+
+		return s.tokenRepo.RevokeUserRefreshTokens(ctx, u.Id)
+	})
+}
+
+// checkAccountStatus rejects accounts that are not allowed to log in. Suspensions and
+// locks that ran out are ignored, the error carries their end when they have one.
+func checkAccountStatus(u *user.User) error {
+	var err error
+
+	switch u.Status {
+	case user.StatusSuspended:
+		err = ErrAccountSuspended
+	case user.StatusLocked:
+		err = ErrAccountLocked
+	case user.StatusPendingDeletion:
+		return ErrAccountPendingDeletion
+	default:
+		return nil
+	}
+
+	if u.StatusUntil == nil {
+		return err
+	}
+
+	if !time.Now().Before(*u.StatusUntil) {
+		return nil
+	}
+
+	return fmt.Errorf("%w until %s", err, u.StatusUntil.UTC().Format(time.RFC3339))
+}
+
+// restoreAccount cancels the deletion of an account, which fails like a missing
+// account when the grace period ran out and the purge is merely pending
+func (s *service) restoreAccount(ctx context.Context, userId int64) (*user.User, error) {
+	if err := s.repo.RestoreAccount(ctx, userId); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidCredentials
+		}
+
+		return nil, err
+	}
+
+	return s.repo.FindById(ctx, userId)
+}
+
+// CurrentUser loads the user behind a session, failing with ErrSessionRevoked
+// when the user is gone or the session predates a revocation
+func (s *service) CurrentUser(rCtx context.Context, us types.UserSession) (*user.User, error) {
+	u, err := s.repo.FindById(rCtx, us.UserID)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSessionRevoked
+		}
+
+		return nil, err
+	}
+
+	if u.SessionVersion != us.SessionVersion || u.DeletedAt != nil || checkAccountStatus(u) != nil {
+		return nil, ErrSessionRevoked
+	}
+
+	return u, nil
 }
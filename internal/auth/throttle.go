@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// AttemptStore keeps the login attempt counters, shared by every instance of the API
+type AttemptStore interface {
+	// Reserve counts an attempt for key unless key is blocked, in which case it returns how
+	// long key still has to wait. Checking and counting are one atomic step, so concurrent
+	// attempts cannot all get through before the first of them is counted. The attempt that
+	// takes key past the free ones blocks it for limit.Backoff.
+	Reserve(ctx context.Context, key string, limit AttemptLimit) (time.Duration, error)
+	// Release takes back one reserved attempt
+	Release(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+// AttemptLimit is how many attempts a key gets within Window before backing off.
+// Past the free attempts every attempt doubles the wait, from BaseDelay up to MaxDelay,
+// which amounts to a temporary lockout. The count is forgotten once Window passes
+// without an attempt, so Window should be at least MaxDelay.
+type AttemptLimit struct {
+	Free      int64
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Window    time.Duration
+}
+
+// Backoff is the wait after the nth attempt past the free ones
+func (l AttemptLimit) Backoff(n int64) time.Duration {
+	d := l.BaseDelay
+
+	for i := int64(1); i < n && d < l.MaxDelay; i++ {
+		d *= 2
+	}
+
+	return min(d, l.MaxDelay)
+}
+
+// ThrottleOptions configures the backoff of logins, per account and per client IP
+type ThrottleOptions struct {
+	AccountFreeAttempts int
+	IpFreeAttempts      int
+	BaseDelay           time.Duration
+	MaxDelay            time.Duration
+	Window              time.Duration
+}
+
+// LoginThrottledError is returned when a login is attempted before the backoff ran out
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return "too many failed login attempts, please wait before trying again"
+}
+
+// LoginThrottle slows down password guessing. Every attempt is reserved before the
+// password is checked, and only a successful one is given back.
+type LoginThrottle struct {
+	store        AttemptStore
+	accountLimit AttemptLimit
+	ipLimit      AttemptLimit
+}
+
+func NewLoginThrottle(store AttemptStore, opts ThrottleOptions) *LoginThrottle {
+	limit := AttemptLimit{
+		BaseDelay: opts.BaseDelay,
+		MaxDelay:  opts.MaxDelay,
+		Window:    opts.Window,
+	}
+
+	accountLimit, ipLimit := limit, limit
+	accountLimit.Free = int64(opts.AccountFreeAttempts)
+	ipLimit.Free = int64(opts.IpFreeAttempts)
+
+	return &LoginThrottle{
+		store:        store,
+		accountLimit: accountLimit,
+		ipLimit:      ipLimit,
+	}
+}
+
+// Reserve counts a login attempt against the IP and the account, failing with a
+// *LoginThrottledError while either is backing off. It is reserved for emails without
+// an account too, so they cannot be told apart.
+func (t *LoginThrottle) Reserve(ctx context.Context, email, ip string) error {
+	wait, err := t.store.Reserve(ctx, ipKey(ip), t.ipLimit)
+	if err != nil {
+		return err
+	}
+
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+
+	wait, err = t.store.Reserve(ctx, accountKey(email), t.accountLimit)
+	if err != nil {
+		return err
+	}
+
+	if wait > 0 {
+		// the attempt is not made after all
+		if err := t.store.Release(ctx, ipKey(ip)); err != nil {
+			return err
+		}
+
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+
+	return nil
+}
+
+// Succeed forgets the attempts of the account and gives back the one of the IP. The other
+// attempts of the IP are kept, or logging into an account of their own would let an
+// attacker keep guessing at others.
+func (t *LoginThrottle) Succeed(ctx context.Context, email, ip string) error {
+	if err := t.store.Reset(ctx, accountKey(email)); err != nil {
+		return err
+	}
+
+	return t.store.Release(ctx, ipKey(ip))
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestAttemptLimitBackoff(t *testing.T) {
+	limit := AttemptLimit{BaseDelay: time.Second, MaxDelay: 8 * time.Second}
+
+	tests := []struct {
+		n    int64
+		want time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 8 * time.Second},
+		{100, 8 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := limit.Backoff(tt.n); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+
+	// a max that is no power of two of the base still caps the wait
+	uneven := AttemptLimit{BaseDelay: 3 * time.Second, MaxDelay: 4 * time.Second}
+	if got := uneven.Backoff(2); got != 4*time.Second {
+		t.Errorf("Backoff(2) = %s, want 4s", got)
+	}
+}
+
+// attemptStores returns the stores to run the store tests against. Redis is only
+// tested when TEST_REDIS_ADDR points at a server, which the tests may write to.
+func attemptStores(t *testing.T) map[string]AttemptStore {
+	stores := map[string]AttemptStore{"memory": NewMemoryAttemptStore()}
+
+	if addr := os.Getenv("TEST_REDIS_ADDR"); addr != "" {
+		client := redis.NewClient(&redis.Options{Addr: addr})
+		t.Cleanup(func() { client.Close() })
+
+		stores["redis"] = NewRedisAttemptStore(client)
+	}
+
+	return stores
+}
+
+func TestAttemptStoreReserve(t *testing.T) {
+	tests := []struct {
+		name string
+		free int64
+		// reserve expects the attempt to be counted, blocked expects a wait
+		steps []string
+	}{
+		{
+			name:  "free attempts pass and the one past them blocks",
+			free:  2,
+			steps: []string{"reserve", "reserve", "reserve", "blocked", "blocked"},
+		},
+		{
+			name:  "release gives an attempt back",
+			free:  2,
+			steps: []string{"reserve", "reserve", "release", "reserve", "reserve", "blocked"},
+		},
+		{
+			name:  "release does not go below zero",
+			free:  1,
+			steps: []string{"release", "release", "reserve", "reserve", "blocked"},
+		},
+		{
+			name:  "reset lifts the block",
+			free:  0,
+			steps: []string{"reserve", "blocked", "reset", "reserve", "blocked"},
+		},
+	}
+
+	limit := AttemptLimit{BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+
+	for storeName, store := range attemptStores(t) {
+		for _, tt := range tests {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				key := "test:" + t.Name()
+				t.Cleanup(func() { store.Reset(ctx, key) })
+
+				limit := limit
+				limit.Free = tt.free
+
+				for i, step := range tt.steps {
+					var err error
+
+					switch step {
+					case "reserve", "blocked":
+						var wait time.Duration
+						wait, err = store.Reserve(ctx, key, limit)
+
+						if step == "reserve" && wait != 0 {
+							t.Fatalf("step %d: expected the attempt to be counted, got a wait of %s", i, wait)
+						}
+
+						if step == "blocked" && (wait <= 0 || wait > limit.MaxDelay) {
+							t.Fatalf("step %d: expected a wait, got %s", i, wait)
+						}
+					case "release":
+						err = store.Release(ctx, key)
+					case "reset":
+						err = store.Reset(ctx, key)
+					}
+
+					if err != nil {
+						t.Fatalf("step %d: %s", i, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestAttemptStoreDoublesTheWait(t *testing.T) {
+	limit := AttemptLimit{Free: 0, BaseDelay: 40 * time.Millisecond, MaxDelay: 160 * time.Millisecond, Window: time.Minute}
+
+	for storeName, store := range attemptStores(t) {
+		t.Run(storeName, func(t *testing.T) {
+			ctx := context.Background()
+			key := "test:" + t.Name()
+			t.Cleanup(func() { store.Reset(ctx, key) })
+
+			for n := int64(1); n <= 4; n++ {
+				if wait, err := store.Reserve(ctx, key, limit); err != nil || wait != 0 {
+					t.Fatalf("attempt %d: expected it to be counted, got %s, %v", n, wait, err)
+				}
+
+				wait, err := store.Reserve(ctx, key, limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := limit.Backoff(n)
+				if wait > want || wait < want-30*time.Millisecond {
+					t.Fatalf("attempt %d: expected a wait of about %s, got %s", n, want, wait)
+				}
+
+				time.Sleep(wait + 10*time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	type attempt struct {
+		email     string
+		succeed   bool
+		throttled bool
+	}
+
+	tests := []struct {
+		name     string
+		attempts []attempt
+	}{
+		{
+			name: "an account is blocked past its free attempts",
+			attempts: []attempt{
+				{email: "jane@example.com"},
+				{email: "jane@example.com"},
+				{email: "jane@example.com"},
+				{email: "jane@example.com", throttled: true},
+			},
+		},
+		{
+			name: "a success forgets the failures of the account",
+			attempts: []attempt{
+				{email: "jane@example.com"},
+				{email: "jane@example.com", succeed: true},
+				{email: "jane@example.com"},
+				{email: "jane@example.com"},
+				{email: "jane@example.com"},
+				{email: "jane@example.com", throttled: true},
+			},
+		},
+		{
+			name: "emails are compared without case and spaces",
+			attempts: []attempt{
+				{email: "jane@example.com"},
+				{email: "Jane@Example.com"},
+				{email: " JANE@example.com "},
+				{email: "jane@example.com", throttled: true},
+			},
+		},
+		{
+			name: "the ip is blocked past its free attempts across accounts",
+			attempts: []attempt{
+				{email: "a@example.com"},
+				{email: "b@example.com"},
+				{email: "c@example.com"},
+				{email: "d@example.com"},
+				{email: "e@example.com"},
+				{email: "f@example.com"},
+				{email: "g@example.com", throttled: true},
+			},
+		},
+		{
+			name: "an attempt refused for the account does not count against the ip",
+			attempts: []attempt{
+				{email: "jane@example.com"},
+				{email: "jane@example.com"},
+				{email: "jane@example.com"},
+				{email: "jane@example.com", throttled: true},
+				{email: "jane@example.com", throttled: true},
+				{email: "b@example.com"},
+				{email: "c@example.com"},
+				{email: "d@example.com"},
+				{email: "e@example.com", throttled: true},
+			},
+		},
+		{
+			name: "a success keeps the other attempts of the ip",
+			attempts: []attempt{
+				{email: "a@example.com"},
+				{email: "b@example.com"},
+				{email: "c@example.com"},
+				{email: "d@example.com"},
+				{email: "mine@example.com", succeed: true},
+				{email: "e@example.com"},
+				{email: "f@example.com"},
+				{email: "g@example.com", throttled: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			throttle := NewLoginThrottle(NewMemoryAttemptStore(), ThrottleOptions{
+				AccountFreeAttempts: 2,
+				IpFreeAttempts:      5,
+				BaseDelay:           time.Minute,
+				MaxDelay:            time.Hour,
+				Window:              time.Hour,
+			})
+
+			for i, a := range tt.attempts {
+				err := throttle.Reserve(ctx, a.email, "192.0.2.1")
+
+				var throttled *LoginThrottledError
+				if errors.As(err, &throttled) != a.throttled {
+					t.Fatalf("attempt %d for %s: expected throttled %t, got %v", i, a.email, a.throttled, err)
+				}
+
+				if err != nil && !a.throttled {
+					t.Fatalf("attempt %d for %s: %s", i, a.email, err)
+				}
+
+				if a.succeed {
+					if err := throttle.Succeed(ctx, a.email, "192.0.2.1"); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore"
+)
+
+// Build writes the user's archive to w as a ZIP with the user row, the logged in
+// devices, the audit events and the original profile picture. Hashes of the password
+// and of tokens are never part of it.
+func (s *service) Build(ctx context.Context, userId int64, w io.Writer) error {
+	u, err := s.users.FindById(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := s.sessions.ListUserRefreshTokens(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	events, err := s.auditLog.ListByUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	sessions := make([]SessionData, len(tokens))
+	for i, t := range tokens {
+		sessions[i] = SessionData{
+			UserAgent:  t.UserAgent,
+			IpAddress:  t.IpAddress,
+			CreatedAt:  t.CreatedAt,
+			LastUsedAt: t.LastUsedAt,
+			ExpiresAt:  t.ExpiresAt,
+		}
+	}
+
+	auditEvents := make([]AuditEventData, len(events))
+	for i, e := range events {
+		auditEvents[i] = AuditEventData{
+			Action:    e.Action,
+			Details:   e.Details,
+			CreatedAt: e.CreatedAt,
+		}
+
+		if e.ActorId != nil {
+			auditEvents[i].ByAdmin = true
+		} else {
+			auditEvents[i].IpAddress = e.IpAddress
+		}
+	}
+
+	archive := zip.NewWriter(w)
+
+	err = writeJSON(archive, "user.json", UserData{
+		Id:             u.Id,
+		Email:          u.Email,
+		PendingEmail:   u.PendingEmail,
+		Role:           u.Role,
+		IsVerified:     u.IsVerified,
+		FullName:       u.FullName,
+		ProfilePicName: u.ProfilePicName,
+		DeletedAt:      u.DeletedAt,
+		CreatedAt:      u.CreatedAt,
+		UpdatedAt:      u.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writeJSON(archive, "sessions.json", sessions); err != nil {
+		return err
+	}
+
+	if err := writeJSON(archive, "audit_events.json", auditEvents); err != nil {
+		return err
+	}
+
+	if u.ProfilePicName != "" {
+		if err := s.writeProfilePic(ctx, archive, u.ProfilePicName); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// writeProfilePic copies the original picture, one that went missing is left out
+func (s *service) writeProfilePic(ctx context.Context, archive *zip.Writer, profilePicName string) error {
+	obj, err := s.fileStore.Get(ctx, profilePicName)
+	if err != nil {
+		if errors.Is(err, filestore.ErrNotFound) {
+			return nil
+		}
+
+		return err
+	}
+	defer obj.Close()
+
+	// images are compressed already
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:   "profile-pic" + path.Ext(profilePicName),
+		Method: zip.Store,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, obj)
+	return err
+}
+
+func writeJSON(archive *zip.Writer, name string, v any) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
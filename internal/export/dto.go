@@ -0,0 +1,36 @@
+package export
+
+import "time"
+
+// UserData is the user row as exported, without the password hash
+type UserData struct {
+	Id             int64      `json:"id"`
+	Email          string     `json:"email"`
+	PendingEmail   *string    `json:"pendingEmail,omitempty"`
+	Role           string     `json:"role"`
+	IsVerified     bool       `json:"isVerified"`
+	FullName       string     `json:"fullName"`
+	ProfilePicName string     `json:"profilePicName,omitempty"`
+	DeletedAt      *time.Time `json:"deletedAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// SessionData is one logged in device, without the refresh token
+type SessionData struct {
+	UserAgent  string    `json:"userAgent"`
+	IpAddress  string    `json:"ipAddress"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// AuditEventData is one audit event as the user sees it. Events done to the account by
+// someone else, e.g. an admin, leave out who that was and where from.
+type AuditEventData struct {
+	Action    string            `json:"action"`
+	Details   map[string]string `json:"details,omitempty"`
+	IpAddress string            `json:"ipAddress,omitempty"`
+	ByAdmin   bool              `json:"byAdmin,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
@@ -0,0 +1,82 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/auth"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/response"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
+)
+
+// retryAfter is suggested to clients polling for a queued export
+const retryAfter = 30 * time.Second
+
+type Service interface {
+	Request(ctx context.Context, userId int64, ipAddress string) (*Result, error)
+	Open(ctx context.Context, e *Export) (*filestore.Object, error)
+}
+
+type Handler struct {
+	service     Service
+	requireAuth func(http.HandlerFunc) http.HandlerFunc
+}
+
+func NewHandler(s Service, requireAuth func(http.HandlerFunc) http.HandlerFunc) *Handler {
+	return &Handler{
+		service:     s,
+		requireAuth: requireAuth,
+	}
+}
+
+// Export downloads the user's personal data archive, or answers 202 while it is generated
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	u, ok := user.GetUserFromContext(r.Context())
+
+	if !ok {
+		response.HandleInternalError(w, "Error retriving user from session")
+		return
+	}
+
+	result, err := h.service.Request(r.Context(), u.UserID, auth.ClientInfoFromRequest(r).IpAddress)
+
+	if err != nil {
+		response.HandleInternalError(w, "Error while exporting data")
+		return
+	}
+
+	if result.Archive != nil {
+		serveArchive(w, r, bytes.NewReader(result.Archive), time.Now())
+		return
+	}
+
+	if result.Export.Status != StatusReady {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		response.Accepted(w, "The export is being generated, try again later")
+		return
+	}
+
+	obj, err := h.service.Open(r.Context(), result.Export)
+
+	if err != nil {
+		response.HandleInternalError(w, "Error retriving data export")
+		return
+	}
+	defer obj.Close()
+
+	serveArchive(w, r, obj, *result.Export.CompletedAt)
+}
+
+func serveArchive(w http.ResponseWriter, r *http.Request, archive io.ReadSeeker, modTime time.Time) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="data-export.zip"`)
+	// personal data must not linger in shared caches
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	http.ServeContent(w, r, "", modTime, archive)
+}
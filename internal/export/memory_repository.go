@@ -0,0 +1,183 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// memoryRepository is an in-memory stand-in for repository, for tests.
+// It returns the same errors as the postgres one, e.g. sql.ErrNoRows.
+type memoryRepository struct {
+	mu      sync.Mutex
+	nextId  int64
+	exports []Export
+	// leases mirrors the lease_until column, which is not part of Export
+	leases map[int64]time.Time
+}
+
+func NewMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		nextId: 1,
+		leases: make(map[int64]time.Time),
+	}
+}
+
+func (r *memoryRepository) CreatePending(ctx context.Context, userId int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.exports {
+		if e.UserId == userId && e.Status == StatusPending {
+			return nil
+		}
+	}
+
+	r.exports = append(r.exports, Export{
+		Id:        r.nextId,
+		UserId:    userId,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	})
+	r.leases[r.nextId] = time.Now()
+	r.nextId++
+
+	return nil
+}
+
+func (r *memoryRepository) FindLatest(ctx context.Context, userId int64) (*Export, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// ids grow with creation time
+	for i := len(r.exports) - 1; i >= 0; i-- {
+		if r.exports[i].UserId == userId {
+			e := r.exports[i]
+			return &e, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (r *memoryRepository) Claim(ctx context.Context, limit int, leaseUntil time.Time) ([]Export, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var exports []Export
+
+	for i := range r.exports {
+		if len(exports) == limit {
+			break
+		}
+
+		e := &r.exports[i]
+		if e.Status != StatusPending || r.leases[e.Id].After(time.Now()) {
+			continue
+		}
+
+		e.Attempts++
+		r.leases[e.Id] = leaseUntil
+		exports = append(exports, *e)
+	}
+
+	return exports, nil
+}
+
+func (r *memoryRepository) MarkReady(ctx context.Context, id int64, objectName string, size int64, expiresAt time.Time) error {
+	return r.update(id, func(e *Export) {
+		now := time.Now()
+		e.Status = StatusReady
+		e.ObjectName = objectName
+		e.Size = size
+		e.ExpiresAt = &expiresAt
+		e.CompletedAt = &now
+		e.LastError = nil
+	})
+}
+
+func (r *memoryRepository) MarkRetry(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error {
+	return r.update(id, func(e *Export) {
+		e.LastError = &lastError
+		r.leases[id] = nextAttemptAt
+	})
+}
+
+func (r *memoryRepository) MarkFailed(ctx context.Context, id int64, lastError string, expiresAt time.Time) error {
+	return r.update(id, func(e *Export) {
+		now := time.Now()
+		e.Status = StatusFailed
+		e.LastError = &lastError
+		e.ExpiresAt = &expiresAt
+		e.CompletedAt = &now
+	})
+}
+
+func (r *memoryRepository) ListExpired(ctx context.Context, limit int) ([]Export, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var exports []Export
+
+	for _, e := range r.exports {
+		if len(exports) == limit {
+			break
+		}
+
+		if e.ExpiresAt != nil && !e.ExpiresAt.After(time.Now()) {
+			exports = append(exports, e)
+		}
+	}
+
+	return exports, nil
+}
+
+func (r *memoryRepository) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, e := range r.exports {
+		if e.Id == id {
+			r.exports = append(r.exports[:i], r.exports[i+1:]...)
+			delete(r.leases, id)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) DeleteByUser(ctx context.Context, userId int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.exports[:0]
+
+	for _, e := range r.exports {
+		if e.UserId == userId {
+			delete(r.leases, e.Id)
+			continue
+		}
+
+		kept = append(kept, e)
+	}
+
+	r.exports = kept
+
+	return nil
+}
+
+func (r *memoryRepository) update(id int64, fn func(e *Export)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.exports {
+		if r.exports[i].Id == id {
+			fn(&r.exports[i])
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
@@ -0,0 +1,24 @@
+package export
+
+import "time"
+
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+// Export is a personal data archive generated in the background. Ready and failed
+// exports are kept until ExpiresAt, then the worker deletes them with their archive.
+type Export struct {
+	Id          int64
+	UserId      int64
+	Status      string
+	ObjectName  string
+	Size        int64
+	Attempts    int
+	LastError   *string
+	ExpiresAt   *time.Time
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+}
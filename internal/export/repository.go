@@ -0,0 +1,201 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/txn"
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *repository {
+	return &repository{db: db}
+}
+
+const exportColumns = `id, user_id, status, object_name, size, attempts, last_error, expires_at, created_at, completed_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanExport(row scanner) (*Export, error) {
+	var e Export
+
+	err := row.Scan(
+		&e.Id,
+		&e.UserId,
+		&e.Status,
+		&e.ObjectName,
+		&e.Size,
+		&e.Attempts,
+		&e.LastError,
+		&e.ExpiresAt,
+		&e.CreatedAt,
+		&e.CompletedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// CreatePending queues an export for the user. A user has at most one pending export,
+// asking again while one is queued is a no-op.
+func (r *repository) CreatePending(ctx context.Context, userId int64) error {
+	query := `INSERT INTO data_exports (user_id, status)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) WHERE status = 'pending' DO NOTHING`
+
+	if _, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, userId, StatusPending); err != nil {
+		return fmt.Errorf("failed to insert data export: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) FindLatest(ctx context.Context, userId int64) (*Export, error) {
+	query := `SELECT ` + exportColumns + `
+	FROM data_exports
+	WHERE user_id = $1
+	ORDER BY created_at DESC, id DESC
+	LIMIT 1`
+
+	return scanExport(txn.Conn(ctx, r.db).QueryRowContext(ctx, query, userId))
+}
+
+// Claim takes up to limit pending exports and leases them until leaseUntil,
+// after which an export a crashed worker was generating becomes due again
+func (r *repository) Claim(ctx context.Context, limit int, leaseUntil time.Time) ([]Export, error) {
+	query := `UPDATE data_exports
+              SET attempts = attempts + 1, lease_until = $1
+              WHERE id IN (
+                  SELECT id FROM data_exports
+                  WHERE status = $2 AND lease_until <= NOW()
+                  ORDER BY id
+                  LIMIT $3
+                  FOR UPDATE SKIP LOCKED
+              )
+              RETURNING ` + exportColumns
+
+	rows, err := r.db.QueryContext(ctx, query, leaseUntil, StatusPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim data exports: %w", err)
+	}
+	defer rows.Close()
+
+	var exports []Export
+
+	for rows.Next() {
+		e, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		exports = append(exports, *e)
+	}
+
+	return exports, rows.Err()
+}
+
+func (r *repository) MarkReady(ctx context.Context, id int64, objectName string, size int64, expiresAt time.Time) error {
+	query := `UPDATE data_exports
+              SET status = $1, object_name = $2, size = $3, expires_at = $4, completed_at = NOW(), last_error = NULL
+              WHERE id = $5`
+
+	result, err := r.db.ExecContext(ctx, query, StatusReady, objectName, size, expiresAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark data export as ready: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+
+	// the row goes away with its user
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// MarkRetry records a failed attempt and schedules the next one
+func (r *repository) MarkRetry(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error {
+	query := `UPDATE data_exports
+              SET last_error = $1, lease_until = $2
+              WHERE id = $3`
+
+	if _, err := r.db.ExecContext(ctx, query, lastError, nextAttemptAt, id); err != nil {
+		return fmt.Errorf("failed to reschedule data export: %w", err)
+	}
+
+	return nil
+}
+
+// MarkFailed gives up on an export, it is kept until expiresAt so the user can see it failed
+func (r *repository) MarkFailed(ctx context.Context, id int64, lastError string, expiresAt time.Time) error {
+	query := `UPDATE data_exports
+              SET status = $1, last_error = $2, expires_at = $3, completed_at = NOW()
+              WHERE id = $4`
+
+	if _, err := r.db.ExecContext(ctx, query, StatusFailed, lastError, expiresAt, id); err != nil {
+		return fmt.Errorf("failed to mark data export as failed: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) ListExpired(ctx context.Context, limit int) ([]Export, error) {
+	query := `SELECT ` + exportColumns + `
+	FROM data_exports
+	WHERE expires_at <= NOW()
+	ORDER BY expires_at
+	LIMIT $1`
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute select query: %w", err)
+	}
+	defer rows.Close()
+
+	var exports []Export
+
+	for rows.Next() {
+		e, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		exports = append(exports, *e)
+	}
+
+	return exports, rows.Err()
+}
+
+func (r *repository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM data_exports WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete data export: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteByUser(ctx context.Context, userId int64) error {
+	query := `DELETE FROM data_exports WHERE user_id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, userId); err != nil {
+		return fmt.Errorf("failed to delete data exports: %w", err)
+	}
+
+	return nil
+}
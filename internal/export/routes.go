@@ -0,0 +1,8 @@
+package export
+
+import "net/http"
+
+// RegisterRoutes adds the export route under the user api
+func (h *Handler) RegisterRoutes(mux *http.ServeMux, prefix string) {
+	mux.HandleFunc("GET "+prefix+"/export", h.requireAuth(h.Export))
+}
@@ -0,0 +1,169 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/audit"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/auth"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
+)
+
+type Repository interface {
+	CreatePending(ctx context.Context, userId int64) error
+	FindLatest(ctx context.Context, userId int64) (*Export, error)
+	Claim(ctx context.Context, limit int, leaseUntil time.Time) ([]Export, error)
+	MarkReady(ctx context.Context, id int64, objectName string, size int64, expiresAt time.Time) error
+	MarkRetry(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error
+	MarkFailed(ctx context.Context, id int64, lastError string, expiresAt time.Time) error
+	ListExpired(ctx context.Context, limit int) ([]Export, error)
+	Delete(ctx context.Context, id int64) error
+	DeleteByUser(ctx context.Context, userId int64) error
+}
+
+type UserFinder interface {
+	FindById(ctx context.Context, id int64) (*user.User, error)
+}
+
+// SessionLister lists the logged in devices of a user
+type SessionLister interface {
+	ListUserRefreshTokens(ctx context.Context, userId int64) ([]auth.RefreshToken, error)
+}
+
+type AuditLog interface {
+	Record(ctx context.Context, e audit.Event) error
+	ListByUser(ctx context.Context, userId int64) ([]audit.Event, error)
+}
+
+type FileStore interface {
+	Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, objectName string) (*filestore.Object, error)
+	Delete(ctx context.Context, objectName string) error
+	List(ctx context.Context, prefix string) ([]filestore.ObjectInfo, error)
+}
+
+// Result is either an archive generated on the spot or the export to wait for
+type Result struct {
+	Archive []byte
+	Export  *Export
+}
+
+type service struct {
+	repo      Repository
+	users     UserFinder
+	sessions  SessionLister
+	auditLog  AuditLog
+	fileStore FileStore
+	syncLimit int64
+	expiry    time.Duration
+}
+
+func NewService(repo Repository, users UserFinder, sessions SessionLister, auditLog AuditLog, fs FileStore, syncLimit int64, expiry time.Duration) *service {
+	return &service{
+		repo:      repo,
+		users:     users,
+		sessions:  sessions,
+		auditLog:  auditLog,
+		fileStore: fs,
+		syncLimit: syncLimit,
+		expiry:    expiry,
+	}
+}
+
+// DeleteUserExports removes every export of a purged user along with the stored archives,
+// which would otherwise keep the user's data around until they expire
+func (s *service) DeleteUserExports(ctx context.Context, userId int64) error {
+	if err := s.repo.DeleteByUser(ctx, userId); err != nil {
+		return err
+	}
+
+	objects, err := s.fileStore.List(ctx, archivePrefix(userId))
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		if err := s.fileStore.Delete(ctx, obj.Name); err != nil {
+			return fmt.Errorf("failed to delete archive %s: %w", obj.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// archivePrefix is where the archives of a user are stored
+func archivePrefix(userId int64) string {
+	return fmt.Sprintf("exports/%d/", userId)
+}
+
+// Request hands out the user's archive. Accounts whose archive fits in syncLimit get it
+// right away, larger ones get an export queued for the Worker. An export that is queued
+// or ready and not expired yet is returned instead of starting over.
+func (s *service) Request(ctx context.Context, userId int64, ipAddress string) (*Result, error) {
+	latest, err := s.repo.FindLatest(ctx, userId)
+
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if latest != nil && (latest.Status == StatusPending || latest.Status == StatusReady && latest.ExpiresAt.After(time.Now())) {
+		return &Result{Export: latest}, nil
+	}
+
+	// recorded first so the archive lists the request it answers
+	if err := s.auditLog.Record(ctx, audit.Event{UserId: userId, Action: audit.ActionDataExportRequested, IpAddress: ipAddress}); err != nil {
+		return nil, err
+	}
+
+	buf := &limitedBuffer{limit: s.syncLimit}
+
+	err = s.Build(ctx, userId, buf)
+
+	if err == nil {
+		return &Result{Archive: buf.Bytes()}, nil
+	}
+
+	if !errors.Is(err, errSyncLimit) {
+		return nil, err
+	}
+
+	if err := s.repo.CreatePending(ctx, userId); err != nil {
+		return nil, err
+	}
+
+	latest, err = s.repo.FindLatest(ctx, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Export: latest}, nil
+}
+
+// Open opens the archive of a ready export
+func (s *service) Open(ctx context.Context, e *Export) (*filestore.Object, error) {
+	return s.fileStore.Get(ctx, e.ObjectName)
+}
+
+var errSyncLimit = errors.New("archive exceeds the synchronous export limit")
+
+// limitedBuffer fails writes past limit, so an archive too large to build
+// within the request is abandoned early
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if int64(b.Len()+len(p)) > b.limit {
+		return 0, errSyncLimit
+	}
+
+	return b.Buffer.Write(p)
+}
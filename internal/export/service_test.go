@@ -0,0 +1,168 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/audit"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/auth"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore/memory"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
+)
+
+type stubUsers map[int64]*user.User
+
+func (u stubUsers) FindById(ctx context.Context, id int64) (*user.User, error) {
+	if found, ok := u[id]; ok {
+		return found, nil
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+type stubSessions []auth.RefreshToken
+
+func (s stubSessions) ListUserRefreshTokens(ctx context.Context, userId int64) ([]auth.RefreshToken, error) {
+	return s, nil
+}
+
+type stubAuditLog []audit.Event
+
+func (a stubAuditLog) Record(ctx context.Context, e audit.Event) error {
+	return nil
+}
+
+func (a stubAuditLog) ListByUser(ctx context.Context, userId int64) ([]audit.Event, error) {
+	return a, nil
+}
+
+func TestBuildLeavesSecretsOut(t *testing.T) {
+	adminId := int64(1)
+
+	users := stubUsers{2: {
+		Id:             2,
+		Email:          "jane@example.com",
+		PasswordHash:   "password-hash",
+		FullName:       "Jane",
+		ProfilePicName: "profile-pics/2.png",
+	}}
+	sessions := stubSessions{{UserId: 2, TokenHash: "token-hash", UserAgent: "curl", IpAddress: "10.0.0.1"}}
+	events := stubAuditLog{
+		{UserId: 2, Action: "login", IpAddress: "10.0.0.1"},
+		{UserId: 2, ActorId: &adminId, Action: "role_changed", IpAddress: "10.0.0.9"},
+	}
+
+	fs := memory.New()
+	if err := fs.Upload(context.Background(), "profile-pics/2.png", strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewService(NewMemoryRepository(), users, sessions, events, fs, 1<<20, time.Hour)
+
+	var buf bytes.Buffer
+	if err := s.Build(context.Background(), 2, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]string)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[f.Name] = string(content)
+	}
+
+	for _, name := range []string{"user.json", "sessions.json", "audit_events.json", "profile-pic.png"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("expected %s in the archive, got %v", name, archive.File)
+		}
+	}
+
+	// an admin's ip address is theirs, not the user's
+	tests := []struct {
+		file    string
+		absent  string
+		present string
+	}{
+		{"user.json", "password-hash", "jane@example.com"},
+		{"sessions.json", "token-hash", "10.0.0.1"},
+		{"audit_events.json", "10.0.0.9", "role_changed"},
+	}
+
+	for _, tt := range tests {
+		if strings.Contains(files[tt.file], tt.absent) {
+			t.Errorf("%s contains %q", tt.file, tt.absent)
+		}
+
+		if !strings.Contains(files[tt.file], tt.present) {
+			t.Errorf("%s is missing %q", tt.file, tt.present)
+		}
+	}
+}
+
+func TestDeleteUserExports(t *testing.T) {
+	ctx := context.Background()
+
+	repo := NewMemoryRepository()
+	fs := memory.New()
+	s := NewService(repo, stubUsers{}, stubSessions{}, stubAuditLog{}, fs, 1<<20, time.Hour)
+
+	for _, userId := range []int64{2, 3} {
+		if err := repo.CreatePending(ctx, userId); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the prefix of user 2 must not match the archives of user 20
+	archives := []string{"exports/2/1.zip", "exports/2/4.zip", "exports/3/2.zip", "exports/20/3.zip"}
+	for _, name := range archives {
+		if err := fs.Upload(ctx, name, strings.NewReader("zip"), 3, "application/zip"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.DeleteUserExports(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.FindLatest(ctx, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected the exports of the user to be gone, got %v", err)
+	}
+
+	if _, err := repo.FindLatest(ctx, 3); err != nil {
+		t.Fatalf("expected the exports of other users to stay, got %v", err)
+	}
+
+	for _, name := range archives {
+		_, err := fs.Stat(ctx, name)
+
+		if strings.HasPrefix(name, "exports/2/") {
+			if !errors.Is(err, filestore.ErrNotFound) {
+				t.Errorf("expected %s to be deleted, got %v", name, err)
+			}
+		} else if err != nil {
+			t.Errorf("expected %s to stay, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	exportBatchSize   = 5
+	exportLease       = 15 * time.Minute
+	exportMaxAttempts = 3
+	exportRetryDelay  = time.Minute
+	expiredBatchSize  = 50
+)
+
+// Worker generates the queued exports and deletes the expired ones with their archives
+type Worker struct {
+	service      *service
+	pollInterval time.Duration
+}
+
+func NewWorker(s *service, pollInterval time.Duration) *Worker {
+	return &Worker{
+		service:      s,
+		pollInterval: pollInterval,
+	}
+}
+
+// Run polls for exports until ctx is cancelled. A claimed export is always finished,
+// so shutting down never leaves one half generated.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.ProcessDue(context.WithoutCancel(ctx))
+		w.deleteExpired(context.WithoutCancel(ctx))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue generates every claimable export and returns how many are ready
+func (w *Worker) ProcessDue(ctx context.Context) int {
+	repo := w.service.repo
+
+	exports, err := repo.Claim(ctx, exportBatchSize, time.Now().Add(exportLease))
+	if err != nil {
+		log.Printf("export: %s", err.Error())
+		return 0
+	}
+
+	ready := 0
+
+	for _, e := range exports {
+		objectName, size, err := w.generate(ctx, e)
+
+		switch {
+		case err == nil:
+			err = repo.MarkReady(ctx, e.Id, objectName, size, time.Now().Add(w.service.expiry))
+
+			if err == nil {
+				ready++
+			}
+
+			// purged while generating, nothing would ever expire the archive
+			if errors.Is(err, sql.ErrNoRows) {
+				if err := w.service.fileStore.Delete(ctx, objectName); err != nil {
+					log.Printf("export: failed to delete archive %s: %s", objectName, err.Error())
+				}
+			}
+		// the account was purged in the meantime
+		case errors.Is(err, sql.ErrNoRows), e.Attempts >= exportMaxAttempts:
+			log.Printf("export: giving up on export %d after %d attempts: %s", e.Id, e.Attempts, err.Error())
+			err = repo.MarkFailed(ctx, e.Id, err.Error(), time.Now().Add(w.service.expiry))
+		default:
+			err = repo.MarkRetry(ctx, e.Id, err.Error(), time.Now().Add(exportRetryDelay))
+		}
+
+		if err != nil {
+			log.Printf("export: %s", err.Error())
+		}
+	}
+
+	return ready
+}
+
+// generate builds the archive in a temp file, so its size is known before uploading
+func (w *Worker) generate(ctx context.Context, e Export) (string, int64, error) {
+	file, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := w.service.Build(ctx, e.UserId, file); err != nil {
+		return "", 0, err
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+
+	objectName := fmt.Sprintf("%s%d.zip", archivePrefix(e.UserId), e.Id)
+
+	if err := w.service.fileStore.Upload(ctx, objectName, file, size, "application/zip"); err != nil {
+		return "", 0, err
+	}
+
+	return objectName, size, nil
+}
+
+func (w *Worker) deleteExpired(ctx context.Context) {
+	repo := w.service.repo
+
+	exports, err := repo.ListExpired(ctx, expiredBatchSize)
+	if err != nil {
+		log.Printf("export: %s", err.Error())
+		return
+	}
+
+	for _, e := range exports {
+		if e.ObjectName != "" {
+			if err := w.service.fileStore.Delete(ctx, e.ObjectName); err != nil {
+				log.Printf("export: failed to delete archive %s: %s", e.ObjectName, err.Error())
+				continue
+			}
+		}
+
+		if err := repo.Delete(ctx, e.Id); err != nil {
+			log.Printf("export: %s", err.Error())
+		}
+	}
+}
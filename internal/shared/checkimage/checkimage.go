@@ -1,42 +1,26 @@
 package checkimage
 
 import (
-	"errors"
 	"io"
 	"mime/multipart"
-	"net/http"
-)
-
-func CheckImage(file multipart.File) error {
-	// Create a buffer to store the header of the file
-	// The http.DetectContentType function only needs the first 512 bytes
-	buff := make([]byte, 512)
-
-	_, err := file.Read(buff)
-	if err != nil && err != io.EOF {
-		return err
-	}
 
-	// Detect the Content-Type
-	filetype := http.DetectContentType(buff)
-
-	// Validate the type
-	switch filetype {
-	case "image/jpeg", "image/png":
-		// It is a valid image type
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/imageproc"
+)
 
-	default:
-		// fmt.Errorf("invalid file type. Only JPEG, PNG, and GIF allowed.")
-		return errors.New("invalid file type. Only JPEG, PNG, and GIF allowed.")
+// CheckImage validates an upload from its image header, without decoding the pixels.
+// Accepted are jpeg, png, gif and webp within the limits of imageproc.Inspect.
+func CheckImage(file multipart.File) (*imageproc.Info, error) {
+	info, err := imageproc.Inspect(io.LimitReader(file, imageproc.MaxFileSize))
+	if err != nil {
+		return nil, err
 	}
 
 	// --- CRITICAL STEP ---
-	// Because the first 512 bytes are read, the file cursor is now at offset 512.
+	// Reading the header moved the file cursor.
 	// "rewind" the cursor back to the start (0), or the saved file will be corrupted.
-	_, err = file.Seek(0, 0)
-	if err != nil {
-		return err
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return info, nil
 }
@@ -9,16 +9,27 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// MinIO settings are only required when it is the selected storage backend
 type MinIO struct {
-	Endpoint  string `yaml:"endpoint" env-required:"true"`
-	Bucket    string `yaml:"bucket" env-required:"true"`
+	Endpoint  string `yaml:"endpoint"`
+	Bucket    string `yaml:"bucket"`
 	UseSSL    bool   `yaml:"use_ssl"`
-	AccessKey string `env:"MINIO_ACCESS_KEY" env-required:"true"`
-	SecretKey string `env:"MINIO_SECRET_KEY" env-required:"true"`
+	AccessKey string `env:"MINIO_ACCESS_KEY"`
+	SecretKey string `env:"MINIO_SECRET_KEY"`
+	// PresignProfilePics redirects profile picture requests to MinIO instead of proxying the bytes
+	PresignProfilePics bool   `yaml:"presign_profile_pics"`
+	PresignedURLExpiry string `yaml:"presigned_url_expiry" env-default:"15m"`
+}
+
+type Storage struct {
+	// Backend is either "minio" or "local"
+	Backend  string `yaml:"backend" env:"STORAGE_BACKEND" env-default:"minio"`
+	LocalDir string `yaml:"local_dir" env-default:"tmp/files"`
 }
 
 type HTTPServer struct {
-	Addr string `yaml:"address" env-required:"true"`
+	Addr      string `yaml:"address" env-required:"true"`
+	PublicURL string `yaml:"public_url" env:"PUBLIC_URL" env-default:"http://localhost:8082"`
 }
 
 type Redis struct {
@@ -47,14 +58,82 @@ type Cookies struct {
 	Session SessionCookie `yaml:"session" env-required:"true"`
 }
 
+type Auth struct {
+	TokenSecret                string `env:"AUTH_TOKEN_SECRET" env-required:"true"`
+	VerificationExpiry         string `yaml:"verification_expiry" env-default:"24h"`
+	VerificationResendCooldown string `yaml:"verification_resend_cooldown" env-default:"1m"`
+	RequireVerifiedEmail       bool   `yaml:"require_verified_email"`
+	PasswordResetUrl           string `yaml:"password_reset_url" env-default:"http://localhost:3000/reset-password"`
+	PasswordResetExpiry        string `yaml:"password_reset_expiry" env-default:"15m"`
+	PasswordResetCooldown      string `yaml:"password_reset_cooldown" env-default:"1m"`
+	PasswordChangeUrl          string `yaml:"password_change_url" env-default:"http://localhost:3000/change-password"`
+	PasswordChangeExpiry       string `yaml:"password_change_expiry" env-default:"15m"`
+	PasswordChangeCooldown     string `yaml:"password_change_cooldown" env-default:"1m"`
+	EmailChangeExpiry          string `yaml:"email_change_expiry" env-default:"24h"`
+	EmailChangeCooldown        string `yaml:"email_change_cooldown" env-default:"1m"`
+}
+
+// LoginThrottle configures the backoff of failed logins. Past its free attempts every
+// failure doubles the wait of an account or IP from base_delay up to max_delay.
+type LoginThrottle struct {
+	AccountFreeAttempts int    `yaml:"account_free_attempts" env-default:"5"`
+	IpFreeAttempts      int    `yaml:"ip_free_attempts" env-default:"20"`
+	BaseDelay           string `yaml:"base_delay" env-default:"1s"`
+	MaxDelay            string `yaml:"max_delay" env-default:"15m"`
+	// Window is how long failures are remembered after the last one
+	Window string `yaml:"window" env-default:"1h"`
+}
+
+// Account configures the deletion of accounts by their owners
+type Account struct {
+	// DeletionGracePeriod is how long a deleted account can still be restored by logging in
+	DeletionGracePeriod string `yaml:"deletion_grace_period" env-default:"720h"`
+	PurgeInterval       string `yaml:"purge_interval" env-default:"1h"`
+}
+
+// Export configures the personal data exports
+type Export struct {
+	// SyncLimit is the largest archive in bytes that is generated within the request,
+	// larger ones are generated in the background
+	SyncLimit    int64  `yaml:"sync_limit" env-default:"5242880"`
+	Expiry       string `yaml:"expiry" env-default:"24h"`
+	PollInterval string `yaml:"poll_interval" env-default:"10s"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port" env-default:"587"`
+	Username string `env:"SMTP_USERNAME"`
+	Password string `env:"SMTP_PASSWORD"`
+}
+
+type Mail struct {
+	// Backend is either "smtp" or "file"
+	Backend string `yaml:"backend" env:"MAIL_BACKEND" env-default:"file"`
+	From    string `yaml:"from" env-default:"no-reply@localhost"`
+	FileDir string `yaml:"file_dir" env-default:"tmp/mail"`
+	SMTP    SMTP   `yaml:"smtp"`
+	// the outbox worker delivers queued emails in the background
+	OutboxPollInterval string `yaml:"outbox_poll_interval" env-default:"5s"`
+	OutboxMaxAttempts  int    `yaml:"outbox_max_attempts" env-default:"8"`
+	// sent and failed emails are deleted once they are older than this
+	OutboxRetention string `yaml:"outbox_retention" env-default:"168h"`
+}
+
 type Config struct {
-	Env          string `yaml:"env" env:"ENV" env-required:"true" env-default:"production"`
-	SqliteDbPath string `yaml:"db_path" env-required:"true"`
-	DbSource     string `env:"POSTGRESQL_DB_SOURCE" env-required:"true"`
-	MinIO        `yaml:"minio"`
-	Redis        `yaml:"redis"`
-	Cookies      `yaml:"cookies" env-required:"true"`
-	HTTPServer   `yaml:"http_server"`
+	Env           string `yaml:"env" env:"ENV" env-required:"true" env-default:"production"`
+	SqliteDbPath  string `yaml:"db_path" env-required:"true"`
+	DbSource      string `env:"POSTGRESQL_DB_SOURCE" env-required:"true"`
+	Storage       `yaml:"storage"`
+	MinIO         `yaml:"minio"`
+	Redis         `yaml:"redis"`
+	Cookies       `yaml:"cookies" env-required:"true"`
+	HTTPServer    `yaml:"http_server"`
+	Auth          `yaml:"auth"`
+	LoginThrottle `yaml:"login_throttle"`
+	Account       `yaml:"account"`
+	Export        `yaml:"export"`
+	Mail          `yaml:"mail"`
 }
 
 func MustLoad() *Config {
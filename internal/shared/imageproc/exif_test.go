@@ -0,0 +1,142 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// withOrientation inserts an APP1 EXIF segment holding the orientation right after the
+// start of image marker of a jpeg
+func withOrientation(jpg []byte, order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+12+4)
+
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], orientationTag)
+	order.PutUint16(tiff[12:], 3) // short
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, app1...)
+
+	return append(out, jpg[2:]...)
+}
+
+func TestJpegOrientation(t *testing.T) {
+	jpg := encodeJPEG(t, 4, 4)
+
+	truncated := withOrientation(jpg, binary.BigEndian, 6)
+	truncated = truncated[:20]
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", jpg, 1},
+		{"little endian", withOrientation(jpg, binary.LittleEndian, 6), 6},
+		{"big endian", withOrientation(jpg, binary.BigEndian, 8), 8},
+		{"upright", withOrientation(jpg, binary.BigEndian, 1), 1},
+		{"out of range", withOrientation(jpg, binary.BigEndian, 9), 1},
+		{"truncated", truncated, 1},
+		{"not a jpeg", encodePNG(t, 4, 4), 1},
+		{"empty", nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// 3x2 pixels numbered row by row:
+	//	0 1 2
+	//	3 4 5
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		src.Set(i%3, i/3, color.RGBA{uint8(i), 0, 0, 255})
+	}
+
+	tests := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{0, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+		{1, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+		{2, [][]uint8{{2, 1, 0}, {5, 4, 3}}},
+		{3, [][]uint8{{5, 4, 3}, {2, 1, 0}}},
+		{4, [][]uint8{{3, 4, 5}, {0, 1, 2}}},
+		{5, [][]uint8{{0, 3}, {1, 4}, {2, 5}}},
+		{6, [][]uint8{{3, 0}, {4, 1}, {5, 2}}},
+		{7, [][]uint8{{5, 2}, {4, 1}, {3, 0}}},
+		{8, [][]uint8{{2, 5}, {1, 4}, {0, 3}}},
+		{9, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+	}
+
+	for _, tt := range tests {
+		img := orient(src, tt.orientation)
+		bounds := img.Bounds()
+
+		if bounds.Dx() != len(tt.want[0]) || bounds.Dy() != len(tt.want) {
+			t.Errorf("orientation %d: expected %dx%d, got %dx%d", tt.orientation, len(tt.want[0]), len(tt.want), bounds.Dx(), bounds.Dy())
+			continue
+		}
+
+		for y, row := range tt.want {
+			for x, want := range row {
+				r, _, _, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+				if got := uint8(r >> 8); got != want {
+					t.Errorf("orientation %d: pixel %d,%d is %d, want %d", tt.orientation, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestProcessAppliesOrientation(t *testing.T) {
+	result, err := Process(withOrientation(encodeJPEG(t, 40, 20), binary.LittleEndian, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range result.Variants {
+		if v.Size != SizeOriginal {
+			continue
+		}
+
+		config, _, err := image.DecodeConfig(bytes.NewReader(v.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// rotated a quarter turn, and stored without the tag that said so
+		if config.Width != 20 || config.Height != 40 {
+			t.Fatalf("expected 20x40, got %dx%d", config.Width, config.Height)
+		}
+
+		if jpegOrientation(v.Data) != 1 {
+			t.Fatal("expected the orientation tag to be dropped")
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package imageproc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+// identiconGrid is the number of cells per side, the left half is mirrored to the right
+const identiconGrid = 5
+
+var identiconBackground = color.RGBA{240, 240, 240, 255}
+
+// Dimension returns the side length a size is rendered at, 0 for unknown sizes
+func Dimension(size string) int {
+	for _, s := range sizes {
+		if s.name == size {
+			return s.max
+		}
+	}
+
+	return 0
+}
+
+// Identicon renders a symmetric pattern derived from seed as a square PNG.
+// The same seed always gives the same image, so it can stand in for a missing avatar.
+func Identicon(seed string, side int) ([]byte, error) {
+	sum := sha256.Sum256([]byte(seed))
+
+	// keep the colour saturated enough to stand out from the background
+	fg := color.RGBA{sum[0]/2 + 64, sum[1]/2 + 64, sum[2]/2 + 64, 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(img, img.Bounds(), &image.Uniform{identiconBackground}, image.Point{}, draw.Src)
+
+	// half a cell of margin on every side
+	cell := side / (identiconGrid + 1)
+	offset := (side - cell*identiconGrid) / 2
+
+	for row := 0; row < identiconGrid; row++ {
+		for col := 0; col < (identiconGrid+1)/2; col++ {
+			bit := row*identiconGrid + col
+			if sum[3+bit/8]>>(bit%8)&1 == 0 {
+				continue
+			}
+
+			for _, c := range []int{col, identiconGrid - 1 - col} {
+				rect := image.Rect(offset+c*cell, offset+row*cell, offset+(c+1)*cell, offset+(row+1)*cell)
+				draw.Draw(img, rect, &image.Uniform{fg}, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,84 @@
+package imageproc
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestIdenticon(t *testing.T) {
+	for _, size := range Sizes() {
+		side := Dimension(size)
+
+		t.Run(size, func(t *testing.T) {
+			data, err := Identicon("42", side)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			again, err := Identicon("42", side)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(data, again) {
+				t.Fatal("expected the same seed to give the same image")
+			}
+
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if img.Bounds() != image.Rect(0, 0, side, side) {
+				t.Fatalf("expected %dx%d, got %s", side, side, img.Bounds())
+			}
+
+			// the pattern is mirrored around the vertical axis
+			for y := 0; y < side; y++ {
+				for x := 0; x < side/2; x++ {
+					if img.At(x, y) != img.At(side-1-x, y) {
+						t.Fatalf("pixel %d,%d differs from its mirror", x, y)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestIdenticonDependsOnTheSeed(t *testing.T) {
+	seen := make(map[string]string)
+
+	for _, seed := range []string{"1", "2", "3", "4", "5"} {
+		data, err := Identicon(seed, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if other, ok := seen[string(data)]; ok {
+			t.Fatalf("seeds %s and %s gave the same image", other, seed)
+		}
+
+		seen[string(data)] = seed
+	}
+}
+
+func TestDimension(t *testing.T) {
+	tests := []struct {
+		size string
+		want int
+	}{
+		{"64", 64},
+		{"256", 256},
+		{SizeOriginal, MaxOriginalSize},
+		{"12", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := Dimension(tt.size); got != tt.want {
+			t.Errorf("Dimension(%q) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Package imageproc turns an uploaded avatar into the sizes that are stored.
+// Images are decoded and encoded again, which drops EXIF, GPS and any other metadata.
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"path"
+	"strings"
+)
+
+var ErrInvalidImage = errors.New("invalid image")
+
+// SizeOriginal is the full picture, only scaled down when it exceeds MaxOriginalSize
+const SizeOriginal = "original"
+
+// MaxOriginalSize caps the longest side of the stored original
+const MaxOriginalSize = 1024
+
+// jpegQuality is used when re-encoding jpeg uploads
+const jpegQuality = 85
+
+// size is one stored variant. Thumbnails are cropped to a centered square.
+type size struct {
+	name   string
+	max    int
+	square bool
+}
+
+var sizes = []size{
+	{name: "64", max: 64, square: true},
+	{name: "256", max: 256, square: true},
+	{name: SizeOriginal, max: MaxOriginalSize},
+}
+
+// Sizes returns the variant names every processed image is stored in
+func Sizes() []string {
+	names := make([]string, len(sizes))
+	for i, s := range sizes {
+		names[i] = s.name
+	}
+
+	return names
+}
+
+// IsSize reports whether name is one of Sizes
+func IsSize(name string) bool {
+	for _, s := range sizes {
+		if s.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ObjectName derives the object a variant is stored under from the original's name,
+// e.g. "profile-pics/1.png" is stored at 64px as "profile-pics/1_64.png"
+func ObjectName(original string, size string) string {
+	if size == SizeOriginal {
+		return original
+	}
+
+	ext := path.Ext(original)
+	return strings.TrimSuffix(original, ext) + "_" + size + ext
+}
+
+// ObjectNames lists the objects of every variant of original
+func ObjectNames(original string) []string {
+	names := make([]string, len(sizes))
+	for i, s := range sizes {
+		names[i] = ObjectName(original, s.name)
+	}
+
+	return names
+}
+
+// Variant is one encoded size of a processed image
+type Variant struct {
+	Size string
+	Data []byte
+}
+
+// Result is a processed image in every size, all encoded in the same format
+type Result struct {
+	ContentType string
+	// Ext includes the leading dot
+	Ext      string
+	Variants []Variant
+}
+
+// Process decodes an image, applies its EXIF orientation and encodes every size.
+// JPEG stays JPEG, PNG, WebP and the first frame of a GIF become PNG to keep transparency.
+func Process(data []byte) (*Result, error) {
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, len(data))
+	}
+
+	// check the dimensions before decoding allocates memory for them
+	if _, err := Inspect(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+
+	// the orientation lives in the metadata we are about to drop, so bake it into the pixels
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	result := &Result{ContentType: formats["jpeg"].contentType, Ext: formats["jpeg"].ext}
+	encode := func(buf *bytes.Buffer, img image.Image) error {
+		return jpeg.Encode(buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+
+	// there is no webp encoder, png keeps its transparency
+	if format == "png" || format == "gif" || format == "webp" {
+		result.ContentType = formats["png"].contentType
+		result.Ext = formats["png"].ext
+		encode = func(buf *bytes.Buffer, img image.Image) error {
+			return png.Encode(buf, img)
+		}
+	}
+
+	// converted once and shared by every size, the variants only crop and scale it down
+	src := toRGBA(img)
+
+	for _, s := range sizes {
+		var buf bytes.Buffer
+
+		if err := encode(&buf, resize(src, s.max, s.square)); err != nil {
+			return nil, fmt.Errorf("failed to encode %s image: %w", s.name, err)
+		}
+
+		result.Variants = append(result.Variants, Variant{Size: s.name, Data: buf.Bytes()})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,213 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// gradient is an opaque image whose pixels differ, so crops and scales can be told apart
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(x + y), 255})
+		}
+	}
+
+	return img
+}
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, gradient(w, h)); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, gradient(w, h), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func encodeGIF(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewPaletted(image.Rect(0, 0, w, h), palette.Plan9)
+
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// pngHeader is a png that stops after its header, enough for Inspect to read the dimensions
+func pngHeader(w, h int) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(w))
+	binary.BigEndian.PutUint32(ihdr[8:], uint32(h))
+	ihdr[12] = 8 // bit depth
+	ihdr[13] = 6 // rgba
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, 13)
+	data = append(data, ihdr...)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+
+	return data
+}
+
+// webp1x1 is a 1x1 lossless webp
+const webp1x1 = "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA=="
+
+func TestProcess(t *testing.T) {
+	webp, err := base64.StdEncoding.DecodeString(webp1x1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type dims struct{ w, h int }
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		// the dimensions of the 64, 256 and original variants
+		want []dims
+	}{
+		{"landscape png", encodePNG(t, 300, 200), "image/png", []dims{{64, 64}, {200, 200}, {300, 200}}},
+		{"portrait png", encodePNG(t, 90, 120), "image/png", []dims{{64, 64}, {90, 90}, {90, 120}}},
+		{"large jpeg", encodeJPEG(t, 2000, 1000), "image/jpeg", []dims{{64, 64}, {256, 256}, {1024, 512}}},
+		{"thin jpeg", encodeJPEG(t, 3000, 2), "image/jpeg", []dims{{2, 2}, {2, 2}, {1024, 1}}},
+		{"gif", encodeGIF(t, 80, 80), "image/png", []dims{{64, 64}, {80, 80}, {80, 80}}},
+		{"webp", webp, "image/png", []dims{{1, 1}, {1, 1}, {1, 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Process(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.ContentType != tt.contentType {
+				t.Fatalf("expected %s, got %s", tt.contentType, result.ContentType)
+			}
+
+			if len(result.Variants) != len(tt.want) {
+				t.Fatalf("expected %d variants, got %d", len(tt.want), len(result.Variants))
+			}
+
+			for i, v := range result.Variants {
+				if v.Size != Sizes()[i] {
+					t.Fatalf("variant %d is %s, want %s", i, v.Size, Sizes()[i])
+				}
+
+				img, format, err := image.Decode(bytes.NewReader(v.Data))
+				if err != nil {
+					t.Fatalf("variant %s: %s", v.Size, err)
+				}
+
+				if "image/"+format != result.ContentType {
+					t.Fatalf("variant %s is encoded as %s", v.Size, format)
+				}
+
+				got := dims{img.Bounds().Dx(), img.Bounds().Dy()}
+				if got != tt.want[i] {
+					t.Fatalf("variant %s is %dx%d, want %dx%d", v.Size, got.w, got.h, tt.want[i].w, tt.want[i].h)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"empty", nil, ErrInvalidImage},
+		{"not an image", []byte("not an image at all"), ErrInvalidImage},
+		{"truncated png", encodePNG(t, 40, 40)[:100], ErrInvalidImage},
+		{"broken webp", append([]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "not really a webp"...), ErrInvalidImage},
+		{"unsupported format", []byte("BM" + string(make([]byte, 64))), ErrInvalidImage},
+		{"too wide", pngHeader(MaxDimension+1, 1), ErrTooLarge},
+		{"too tall", pngHeader(1, MaxDimension+1), ErrTooLarge},
+		{"too many pixels", pngHeader(4001, 4001), ErrTooLarge},
+		{"too many bytes", make([]byte, MaxFileSize+1), ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Process(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestObjectName(t *testing.T) {
+	tests := []struct {
+		original string
+		size     string
+		want     string
+	}{
+		{"profile-pics/1.png", SizeOriginal, "profile-pics/1.png"},
+		{"profile-pics/1.png", "64", "profile-pics/1_64.png"},
+		{"profile-pics/1.jpg", "256", "profile-pics/1_256.jpg"},
+		{"profile-pics/1", "64", "profile-pics/1_64"},
+	}
+
+	for _, tt := range tests {
+		if got := ObjectName(tt.original, tt.size); got != tt.want {
+			t.Errorf("ObjectName(%q, %q) = %q, want %q", tt.original, tt.size, got, tt.want)
+		}
+	}
+
+	if names := ObjectNames("profile-pics/1.png"); len(names) != len(Sizes()) {
+		t.Errorf("expected a name per size, got %v", names)
+	}
+}
+
+func TestResizeKeepsColours(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for i := range src.Pix {
+		src.Pix[i] = 200
+	}
+
+	dst := resize(src, 64, true)
+
+	if dst.Bounds().Dx() != 64 || dst.Bounds().Dy() != 64 {
+		t.Fatalf("expected 64x64, got %s", dst.Bounds())
+	}
+
+	// averaging a uniform image must not darken or lighten it
+	for _, p := range dst.Pix {
+		if p != 200 {
+			t.Fatalf("expected every channel to stay 200, got %d", p)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package imageproc
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+
+	_ "golang.org/x/image/webp"
+)
+
+var ErrTooLarge = errors.New("image too large")
+
+const (
+	// MaxFileSize is the largest upload accepted, in bytes
+	MaxFileSize = 10 << 20
+
+	// MaxDimension caps the width and the height an image claims in its header
+	MaxDimension = 8192
+
+	// MaxPixels caps width*height, a small file can otherwise decode into gigabytes.
+	// Decoding and the RGBA copy take about 8 bytes per pixel, so 128MB per upload at most.
+	MaxPixels = 16_000_000
+)
+
+// Info is what the header of an image says about it
+type Info struct {
+	// Format is the name the decoder is registered under, e.g. "jpeg" or "webp"
+	Format string
+	Width  int
+	Height int
+}
+
+// formats maps the accepted formats to the content type and extension they are stored with
+var formats = map[string]struct {
+	contentType string
+	ext         string
+}{
+	"jpeg": {"image/jpeg", ".jpg"},
+	"png":  {"image/png", ".png"},
+	"gif":  {"image/gif", ".gif"},
+	"webp": {"image/webp", ".webp"},
+}
+
+// Inspect reads only the image header, so it is cheap enough to run before decoding.
+// It fails with ErrInvalidImage for unsupported or malformed files and with ErrTooLarge
+// when decoding would allocate more than the limits allow.
+func Inspect(r io.Reader) (*Info, error) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+
+	if _, ok := formats[format]; !ok {
+		return nil, fmt.Errorf("%w: unsupported format %s", ErrInvalidImage, format)
+	}
+
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("%w: empty image", ErrInvalidImage)
+	}
+
+	if config.Width > MaxDimension || config.Height > MaxDimension || config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooLarge, config.Width, config.Height)
+	}
+
+	return &Info{
+		Format: format,
+		Width:  config.Width,
+		Height: config.Height,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package imageproc
+
+import (
+	"image"
+	"image/draw"
+)
+
+// resize scales src down so its longest side is at most max, never up.
+// With square set the centered square of the image is used. The result may share
+// its pixels with src, which therefore must not be modified afterwards.
+func resize(src *image.RGBA, max int, square bool) *image.RGBA {
+	bounds := src.Bounds()
+
+	if square {
+		side := min(bounds.Dx(), bounds.Dy())
+		x0 := bounds.Min.X + (bounds.Dx()-side)/2
+		y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+		bounds = image.Rect(x0, y0, x0+side, y0+side)
+	}
+
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+
+	if w > max || h > max {
+		if w >= h {
+			dw, dh = max, max1(h*max/w)
+		} else {
+			dw, dh = max1(w*max/h), max
+		}
+	}
+
+	// cropping only narrows the bounds, no pixels are copied
+	cropped := src.SubImage(bounds).(*image.RGBA)
+	if dw == w && dh == h {
+		return cropped
+	}
+
+	return boxDownscale(cropped, dw, dh)
+}
+
+func max1(v int) int {
+	return max(v, 1)
+}
+
+// toRGBA copies img into a fresh RGBA image anchored at 0,0, unless it already is one
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// boxDownscale averages every source pixel that falls into a destination pixel.
+// RGBA is alpha-premultiplied, so transparent pixels do not bleed their colour.
+func boxDownscale(src *image.RGBA, dw, dh int) *image.RGBA {
+	origin := src.Bounds().Min
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for dy := 0; dy < dh; dy++ {
+		y0 := dy * sh / dh
+		y1 := max(y0+1, (dy+1)*sh/dh)
+
+		for dx := 0; dx < dw; dx++ {
+			x0 := dx * sw / dw
+			x1 := max(x0+1, (dx+1)*sw/dw)
+
+			var r, g, b, a, n uint64
+
+			for y := y0; y < y1; y++ {
+				row := src.Pix[src.PixOffset(origin.X, origin.Y+y):]
+
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+
+			p := dst.Pix[dy*dst.Stride+dx*4 : dy*dst.Stride+dx*4+4]
+			p[0] = uint8(r / n)
+			p[1] = uint8(g / n)
+			p[2] = uint8(b / n)
+			p[3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer drops every message as an .eml file into a directory instead of sending it.
+// Meant for local development and tests, the files open in any mail client.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+var _ Mailer = (*FileMailer)(nil)
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	return &FileMailer{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes(m.from)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), hex.EncodeToString(suffix))
+
+	// write to a temp file first so readers never see a half written message
+	tmp, err := os.CreateTemp(m.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create mail file: %w", err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(m.dir, name))
+}
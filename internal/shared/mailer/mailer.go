@@ -0,0 +1,116 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/config"
+)
+
+// Mailer delivers a single email. The application depends on THIS, not on SMTP.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New picks the backend configured in cfg.Mail
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.Mail.Backend {
+	case "smtp":
+		return NewSMTPMailer(cfg.Mail.SMTP.Host, cfg.Mail.SMTP.Port, cfg.Mail.SMTP.Username, cfg.Mail.SMTP.Password, cfg.Mail.From), nil
+	case "file":
+		return NewFileMailer(cfg.Mail.FileDir, cfg.Mail.From)
+	default:
+		return nil, fmt.Errorf("unknown mail backend: %s", cfg.Mail.Backend)
+	}
+}
+
+// Message is a rendered email with a plain text and an html alternative
+type Message struct {
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+// Bytes encodes the message as an RFC 5322 email with a multipart/alternative body
+func (m *Message) Bytes(from string) ([]byte, error) {
+	if strings.ContainsAny(from+m.To, "\r\n") {
+		return nil, errors.New("invalid address: header injection attempt")
+	}
+
+	var buf bytes.Buffer
+
+	messageId, err := newMessageId(from)
+	if err != nil {
+		return nil, err
+	}
+
+	body := multipart.NewWriter(&buf)
+
+	headers := []string{
+		"From: " + from,
+		"To: " + m.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", m.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: " + messageId,
+		"MIME-Version: 1.0",
+		fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q", body.Boundary()),
+	}
+
+	buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	if err := writePart(body, "text/plain", m.TextBody); err != nil {
+		return nil, err
+	}
+
+	if err := writePart(body, "text/html", m.HTMLBody); err != nil {
+		return nil, err
+	}
+
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writePart(w *multipart.Writer, contentType string, content string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+
+	return qp.Close()
+}
+
+func newMessageId(from string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at != -1 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
@@ -0,0 +1,273 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		msg     Message
+		wantErr bool
+	}{
+		{
+			name: "plain",
+			from: "Go Auth <no-reply@example.com>",
+			msg:  Message{To: "jane@example.com", Subject: "Verify your email", TextBody: "hello", HTMLBody: "<p>hello</p>"},
+		},
+		{
+			name: "non ascii subject",
+			from: "no-reply@example.com",
+			msg:  Message{To: "jane@example.com", Subject: "Grüße", TextBody: "hello", HTMLBody: "<p>hello</p>"},
+		},
+		{
+			name: "line break in the subject is encoded",
+			from: "no-reply@example.com",
+			msg:  Message{To: "jane@example.com", Subject: "hi\r\nBcc: eve@example.com", TextBody: "hello", HTMLBody: "<p>hello</p>"},
+		},
+		{
+			name:    "header injection in the recipient",
+			from:    "no-reply@example.com",
+			msg:     Message{To: "jane@example.com\r\nBcc: eve@example.com", Subject: "hi"},
+			wantErr: true,
+		},
+		{
+			name:    "bare line feed in the recipient",
+			from:    "no-reply@example.com",
+			msg:     Message{To: "jane@example.com\nBcc: eve@example.com", Subject: "hi"},
+			wantErr: true,
+		},
+		{
+			name:    "header injection in the sender",
+			from:    "no-reply@example.com\rBcc: eve@example.com",
+			msg:     Message{To: "jane@example.com", Subject: "hi"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.msg.Bytes(tt.from)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := mail.ReadMessage(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if parsed.Header.Get("Bcc") != "" {
+				t.Fatal("unexpected Bcc header")
+			}
+
+			if got := parsed.Header.Get("To"); got != tt.msg.To {
+				t.Fatalf("To = %q, want %q", got, tt.msg.To)
+			}
+
+			subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+			if err != nil || subject != tt.msg.Subject {
+				t.Fatalf("Subject = %q, want %q (%v)", subject, tt.msg.Subject, err)
+			}
+
+			if !strings.HasSuffix(parsed.Header.Get("Message-ID"), "@example.com>") {
+				t.Fatalf("expected the Message-ID on the sender's domain, got %q", parsed.Header.Get("Message-ID"))
+			}
+
+			bodies := readParts(t, parsed)
+
+			if bodies["text/plain"] != tt.msg.TextBody || bodies["text/html"] != tt.msg.HTMLBody {
+				t.Fatalf("unexpected bodies %q", bodies)
+			}
+		})
+	}
+}
+
+// readParts decodes the alternatives of a message by content type
+func readParts(t *testing.T, msg *mail.Message) map[string]string {
+	t.Helper()
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := make(map[string]string)
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+
+	for {
+		part, err := parts.NextRawPart()
+		if err == io.EOF {
+			return bodies
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		bodies[contentType] = string(body)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// fakeSMTPServer accepts one message and records the commands it was sent
+func fakeSMTPServer(t *testing.T) (string, int, <-chan []string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	commands := make(chan []string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var seen []string
+		defer func() { commands <- seen }()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			line = strings.TrimRight(line, "\r\n")
+			seen = append(seen, line)
+
+			switch verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); verb {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "DATA":
+				reply("354 go ahead")
+
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+				}
+
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+
+	return addr.IP.String(), addr.Port, commands
+}
+
+func TestSMTPMailerEnvelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		wantMail string
+		wantRcpt string
+	}{
+		{"bare addresses", "no-reply@example.com", "jane@example.com", "MAIL FROM:<no-reply@example.com>", "RCPT TO:<jane@example.com>"},
+		{"display names", "Go Auth <no-reply@example.com>", "Jane Doe <jane@example.com>", "MAIL FROM:<no-reply@example.com>", "RCPT TO:<jane@example.com>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port, commands := fakeSMTPServer(t)
+
+			m := NewSMTPMailer(host, port, "", "", tt.from)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := m.Send(ctx, &Message{To: tt.to, Subject: "hi", TextBody: "hello", HTMLBody: "<p>hello</p>"}); err != nil {
+				t.Fatal(err)
+			}
+
+			seen := strings.Join(<-commands, "\n")
+
+			for _, want := range []string{tt.wantMail, tt.wantRcpt} {
+				if !strings.Contains(seen, want) {
+					t.Fatalf("expected %q among the commands:\n%s", want, seen)
+				}
+			}
+		})
+	}
+}
+
+func TestSMTPMailerRejectsInvalidAddresses(t *testing.T) {
+	m := NewSMTPMailer("127.0.0.1", 1, "", "", "not an address")
+
+	err := m.Send(context.Background(), &Message{To: "jane@example.com", Subject: "hi"})
+	if err == nil || !strings.Contains(err.Error(), "invalid sender address") {
+		t.Fatalf("expected an invalid sender error, got %v", err)
+	}
+
+	m = NewSMTPMailer("127.0.0.1", 1, "", "", "no-reply@example.com")
+
+	err = m.Send(context.Background(), &Message{To: "jane", Subject: "hi"})
+	if err == nil || !strings.Contains(err.Error(), "invalid recipient address") {
+		t.Fatalf("expected an invalid recipient error, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import "context"
+
+// Notifier renders the application's emails and hands them to a Mailer
+type Notifier struct {
+	mailer    Mailer
+	templates *Templates
+}
+
+func NewNotifier(m Mailer, t *Templates) *Notifier {
+	return &Notifier{
+		mailer:    m,
+		templates: t,
+	}
+}
+
+func (n *Notifier) SendVerificationEmail(ctx context.Context, to string, fullName string, link string) error {
+	return n.send(ctx, "verification", to, "Verify your email address", templateData{FullName: fullName, Link: link})
+}
+
+func (n *Notifier) SendPasswordResetEmail(ctx context.Context, to string, fullName string, link string) error {
+	return n.send(ctx, "password_reset", to, "Reset your password", templateData{FullName: fullName, Link: link})
+}
+
+func (n *Notifier) SendPasswordChangeEmail(ctx context.Context, to string, fullName string, link string) error {
+	return n.send(ctx, "password_change", to, "Change your password", templateData{FullName: fullName, Link: link})
+}
+
+func (n *Notifier) SendEmailChangeConfirmation(ctx context.Context, to string, fullName string, link string) error {
+	return n.send(ctx, "email_change_confirm", to, "Confirm your new email address", templateData{FullName: fullName, Link: link})
+}
+
+func (n *Notifier) SendEmailChangeNotice(ctx context.Context, to string, fullName string, newEmail string, cancelLink string) error {
+	return n.send(ctx, "email_change_notice", to, "Your email address is being changed", templateData{FullName: fullName, Link: cancelLink, NewEmail: newEmail})
+}
+
+func (n *Notifier) send(ctx context.Context, name, to, subject string, data templateData) error {
+	msg, err := n.templates.Render(name, to, subject, data)
+	if err != nil {
+		return err
+	}
+
+	return n.mailer.Send(ctx, msg)
+}
@@ -0,0 +1,141 @@
+package mailer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/txn"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+// OutboxMessage is a queued message together with its delivery bookkeeping
+type OutboxMessage struct {
+	Id       int64
+	Message  Message
+	Attempts int
+}
+
+// Outbox is a Mailer that only queues messages in the email_outbox table.
+// Send joins the transaction carried by ctx, so the message is stored if and only if
+// the change that triggered it is committed. The Worker does the actual delivery.
+// Bodies carry live token links, so they are cleared as soon as a message is done with.
+type Outbox struct {
+	db *sql.DB
+}
+
+var _ Mailer = (*Outbox)(nil)
+
+func NewOutbox(db *sql.DB) *Outbox {
+	return &Outbox{db: db}
+}
+
+func (o *Outbox) Send(ctx context.Context, msg *Message) error {
+	query := `INSERT INTO email_outbox (
+		recipient,
+		subject,
+		text_body,
+		html_body
+	) VALUES (
+		$1, $2, $3, $4
+	)`
+
+	if _, err := txn.Conn(ctx, o.db).ExecContext(ctx, query, msg.To, msg.Subject, msg.TextBody, msg.HTMLBody); err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+
+	return nil
+}
+
+// Claim takes up to limit due messages and pushes their next attempt to leaseUntil,
+// so a crashed worker's messages become due again once the lease runs out.
+// SKIP LOCKED lets several instances claim concurrently without sending twice.
+func (o *Outbox) Claim(ctx context.Context, limit int, leaseUntil time.Time) ([]OutboxMessage, error) {
+	query := `UPDATE email_outbox
+              SET attempts = attempts + 1, next_attempt_at = $1
+              WHERE id IN (
+                  SELECT id FROM email_outbox
+                  WHERE status = $2 AND next_attempt_at <= NOW()
+                  ORDER BY id
+                  LIMIT $3
+                  FOR UPDATE SKIP LOCKED
+              )
+              RETURNING id, recipient, subject, text_body, html_body, attempts`
+
+	rows, err := o.db.QueryContext(ctx, query, leaseUntil, OutboxPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+
+	for rows.Next() {
+		var m OutboxMessage
+
+		if err := rows.Scan(&m.Id, &m.Message.To, &m.Message.Subject, &m.Message.TextBody, &m.Message.HTMLBody, &m.Attempts); err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+func (o *Outbox) MarkSent(ctx context.Context, id int64) error {
+	query := `UPDATE email_outbox
+              SET status = $1, sent_at = NOW(), last_error = NULL, text_body = NULL, html_body = NULL
+              WHERE id = $2`
+
+	if _, err := o.db.ExecContext(ctx, query, OutboxSent, id); err != nil {
+		return fmt.Errorf("failed to mark email as sent: %w", err)
+	}
+
+	return nil
+}
+
+// MarkRetry records a failed attempt and schedules the next one
+func (o *Outbox) MarkRetry(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error {
+	query := `UPDATE email_outbox
+              SET last_error = $1, next_attempt_at = $2
+              WHERE id = $3`
+
+	if _, err := o.db.ExecContext(ctx, query, lastError, nextAttemptAt, id); err != nil {
+		return fmt.Errorf("failed to reschedule email: %w", err)
+	}
+
+	return nil
+}
+
+// MarkFailed gives up on a message for good
+func (o *Outbox) MarkFailed(ctx context.Context, id int64, lastError string) error {
+	query := `UPDATE email_outbox
+              SET status = $1, last_error = $2, text_body = NULL, html_body = NULL
+              WHERE id = $3`
+
+	if _, err := o.db.ExecContext(ctx, query, OutboxFailed, lastError, id); err != nil {
+		return fmt.Errorf("failed to mark email as failed: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFinished removes the sent and failed messages queued before the cutoff
+func (o *Outbox) DeleteFinished(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM email_outbox
+              WHERE status IN ($1, $2) AND created_at < $3`
+
+	result, err := o.db.ExecContext(ctx, query, OutboxSent, OutboxFailed, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete finished emails: %w", err)
+	}
+
+	return result.RowsAffected()
+}
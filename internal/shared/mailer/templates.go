@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*.html templates/*.txt
+var templateFS embed.FS
+
+// Templates holds the html and plain text variant of every message type.
+// A message type "name" is made of templates/name.html and templates/name.txt.
+type Templates struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// templateData is what every template gets to render
+type templateData struct {
+	FullName string
+	Link     string
+	// NewEmail is only set for email change notices
+	NewEmail string
+}
+
+func LoadTemplates() (*Templates, error) {
+	html, err := htmltemplate.ParseFS(templateFS, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := texttemplate.ParseFS(templateFS, "templates/*.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Templates{html: html, text: text}, nil
+}
+
+// Render builds a message of the given type addressed to a single recipient
+func (t *Templates) Render(name, to, subject string, data any) (*Message, error) {
+	var htmlBody, textBody bytes.Buffer
+
+	if err := t.html.ExecuteTemplate(&htmlBody, name+".html", data); err != nil {
+		return nil, err
+	}
+
+	if err := t.text.ExecuteTemplate(&textBody, name+".txt", data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:       to,
+		Subject:  subject,
+		TextBody: textBody.String(),
+		HTMLBody: htmlBody.String(),
+	}, nil
+}
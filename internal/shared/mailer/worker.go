@@ -0,0 +1,101 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	outboxBatchSize   = 10
+	outboxLease       = 5 * time.Minute
+	outboxSendTimeout = 30 * time.Second
+	baseRetryDelay    = 30 * time.Second
+	maxRetryDelay     = time.Hour
+)
+
+// Worker delivers the messages queued in the Outbox with the real Mailer,
+// retrying failures with exponential backoff. Finished messages are deleted
+// once they are older than retention.
+type Worker struct {
+	outbox       *Outbox
+	mailer       Mailer
+	pollInterval time.Duration
+	maxAttempts  int
+	retention    time.Duration
+}
+
+func NewWorker(outbox *Outbox, m Mailer, pollInterval time.Duration, maxAttempts int, retention time.Duration) *Worker {
+	return &Worker{
+		outbox:       outbox,
+		mailer:       m,
+		pollInterval: pollInterval,
+		maxAttempts:  maxAttempts,
+		retention:    retention,
+	}
+}
+
+// Run polls the outbox until ctx is cancelled. A batch that is already claimed
+// is always finished, so shutting down never leaves a message half processed.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.deliverDue(context.WithoutCancel(ctx))
+		w.deleteFinished(context.WithoutCancel(ctx))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) deliverDue(ctx context.Context) {
+	messages, err := w.outbox.Claim(ctx, outboxBatchSize, time.Now().Add(outboxLease))
+	if err != nil {
+		log.Printf("outbox: %s", err.Error())
+		return
+	}
+
+	for _, m := range messages {
+		sendCtx, cancel := context.WithTimeout(ctx, outboxSendTimeout)
+		err := w.mailer.Send(sendCtx, &m.Message)
+		cancel()
+
+		switch {
+		case err == nil:
+			err = w.outbox.MarkSent(ctx, m.Id)
+		case m.Attempts >= w.maxAttempts:
+			log.Printf("outbox: giving up on email %d after %d attempts: %s", m.Id, m.Attempts, err.Error())
+			err = w.outbox.MarkFailed(ctx, m.Id, err.Error())
+		default:
+			err = w.outbox.MarkRetry(ctx, m.Id, err.Error(), time.Now().Add(retryDelay(m.Attempts)))
+		}
+
+		if err != nil {
+			log.Printf("outbox: %s", err.Error())
+		}
+	}
+}
+
+func (w *Worker) deleteFinished(ctx context.Context) {
+	if _, err := w.outbox.DeleteFinished(ctx, time.Now().Add(-w.retention)); err != nil {
+		log.Printf("outbox: %s", err.Error())
+	}
+}
+
+// retryDelay doubles with every attempt: 30s, 1m, 2m, ... capped at an hour
+func retryDelay(attempts int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+
+	return delay
+}
@@ -10,8 +10,10 @@ import (
 )
 
 type ErrorResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
+	Success bool `json:"success"`
+	// Code tells apart errors sharing a status code, for clients to switch on
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error"`
 }
 
 func WriteJSON(w http.ResponseWriter, statusCode int, data any) error {
@@ -36,6 +38,8 @@ func HandleValidationErrors(w http.ResponseWriter, err error) {
 			switch e.Tag() {
 			case "required":
 				errMsgs = append(errMsgs, fmt.Sprintf("%s is required", e.Field()))
+			case "required_without":
+				errMsgs = append(errMsgs, fmt.Sprintf("%s or %s is required", e.Field(), e.Param()))
 			case "email":
 				errMsgs = append(errMsgs, fmt.Sprintf("%s is not a valid email", e.Field()))
 			case "min":
@@ -73,6 +77,35 @@ func HandleUnauthorized(w http.ResponseWriter, err string) error {
 	return WriteJSON(w, http.StatusUnauthorized, *GeneralError(err))
 }
 
+func HandleNotFound(w http.ResponseWriter, err string) error {
+	return WriteJSON(w, http.StatusNotFound, *GeneralError(err))
+}
+
+func HandleForbidden(w http.ResponseWriter, err string) error {
+	return WriteJSON(w, http.StatusForbidden, *GeneralError(err))
+}
+
+func HandlePayloadTooLarge(w http.ResponseWriter, err string) error {
+	return WriteJSON(w, http.StatusRequestEntityTooLarge, *GeneralError(err))
+}
+
+func HandleUnsupportedMediaType(w http.ResponseWriter, err string) error {
+	return WriteJSON(w, http.StatusUnsupportedMediaType, *GeneralError(err))
+}
+
+func HandleTooManyRequests(w http.ResponseWriter, err string) error {
+	return WriteJSON(w, http.StatusTooManyRequests, *GeneralError(err))
+}
+
+// HandleErrorWithCode writes an error carrying a machine readable code
+func HandleErrorWithCode(w http.ResponseWriter, statusCode int, code string, err string) error {
+	return WriteJSON(w, statusCode, ErrorResponse{
+		Success: false,
+		Code:    code,
+		Error:   err,
+	})
+}
+
 type ResponseWrapper struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
@@ -95,6 +128,22 @@ func Retrived(w http.ResponseWriter, fieldName string, data any) error {
 	})
 }
 
+func Updated(w http.ResponseWriter, fieldName string, data any) error {
+	return WriteJSON(w, http.StatusOK, ResponseWrapper{
+		Success: true,
+		Message: fmt.Sprintf("The %s is updated successfully", fieldName),
+		Data:    data,
+	})
+}
+
+// Accepted acknowledges a request whose effect happens out of band, e.g. an email being sent
+func Accepted(w http.ResponseWriter, message string) error {
+	return WriteJSON(w, http.StatusAccepted, ResponseWrapper{
+		Success: true,
+		Message: message,
+	})
+}
+
 func NoContent(w http.ResponseWriter) error {
 	return WriteJSON(w, http.StatusNoContent, nil)
 }
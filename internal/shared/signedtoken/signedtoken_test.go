@@ -0,0 +1,102 @@
+package signedtoken_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/signedtoken"
+)
+
+// tamper rewrites the payload of a token and keeps its signature
+func tamper(t *testing.T, token string, rewrite func(payload string) string) string {
+	t.Helper()
+
+	encodedPayload, signature, _ := strings.Cut(token, ".")
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(rewrite(string(payload)))) + "." + signature
+}
+
+func TestVerify(t *testing.T) {
+	signer := signedtoken.New("test-secret")
+
+	valid, _, err := signer.Sign("verify-email", 42, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, _, err := signer.Sign("verify-email", 42, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	foreign, _, err := signedtoken.New("other-secret").Sign("verify-email", 42, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, signature, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+		wantErr error
+	}{
+		{"valid", valid, "verify-email", nil},
+		{"other purpose", valid, "reset-password", signedtoken.ErrInvalid},
+		{"expired", expired, "verify-email", signedtoken.ErrExpired},
+		{"signed with another secret", foreign, "verify-email", signedtoken.ErrInvalid},
+		{"other subject", tamper(t, valid, func(p string) string { return strings.Replace(p, "|42|", "|43|", 1) }), "verify-email", signedtoken.ErrInvalid},
+		{"other purpose in the payload", tamper(t, valid, func(p string) string { return strings.Replace(p, "verify-email", "reset-password", 1) }), "reset-password", signedtoken.ErrInvalid},
+		{"extended expiry", tamper(t, expired, func(p string) string {
+			parts := strings.Split(p, "|")
+			parts[2] = "99999999999"
+			return strings.Join(parts, "|")
+		}), "verify-email", signedtoken.ErrInvalid},
+		{"truncated signature", payload + "." + signature[:len(signature)-2], "verify-email", signedtoken.ErrInvalid},
+		{"signature not base64", payload + ".!!!", "verify-email", signedtoken.ErrInvalid},
+		{"no signature", payload, "verify-email", signedtoken.ErrInvalid},
+		{"empty", "", "verify-email", signedtoken.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := signer.Verify(tt.token, tt.purpose)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+
+			if tt.wantErr == nil && (claims.Subject != 42 || claims.Purpose != tt.purpose) {
+				t.Fatalf("unexpected claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestSignIsUnique(t *testing.T) {
+	signer := signedtoken.New("test-secret")
+
+	a, _, err := signer.Sign("verify-email", 42, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _, err := signer.Sign("verify-email", 42, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tokens are stored and burnt one by one, two issued at once must differ
+	if a == b {
+		t.Fatal("expected two tokens for the same subject to differ")
+	}
+}
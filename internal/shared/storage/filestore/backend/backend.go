@@ -0,0 +1,33 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/config"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore/local"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore/minio"
+)
+
+// New picks the file store configured in cfg.Storage
+func New(cfg *config.Config) (filestore.FileStore, error) {
+	switch cfg.Storage.Backend {
+	case "minio":
+		return minio.New(
+			cfg.Endpoint,
+			cfg.AccessKey,
+			cfg.SecretKey,
+			cfg.Bucket,
+			cfg.UseSSL,
+		)
+	case "local":
+		if cfg.MinIO.PresignProfilePics {
+			return nil, errors.New("minio.presign_profile_pics requires the minio storage backend")
+		}
+
+		return local.New(cfg.Storage.LocalDir)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Storage.Backend)
+	}
+}
@@ -2,18 +2,50 @@ package filestore
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
 )
 
+var (
+	ErrNotFound            = errors.New("object not found")
+	ErrPresignNotSupported = errors.New("presigned urls are not supported by this file store")
+)
+
+// ObjectInfo is the metadata needed to serve an object over http
+type ObjectInfo struct {
+	// Name is only set by List
+	Name         string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// Object is an opened file. Seeking lets http.ServeContent answer range requests.
+type Object struct {
+	io.ReadSeekCloser
+	Info ObjectInfo
+}
+
 // FileStore defines the behavior for file operations.
 // The Application Logic (Service) depends on THIS, not on MinIO.
 type FileStore interface {
 	// Upload streams data to the storage
 	Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error
 
+	// Get opens a file for reading, returns ErrNotFound if it does not exist
+	Get(ctx context.Context, objectName string) (*Object, error)
+
+	// Stat returns the metadata of a file without opening it, ErrNotFound if it does not exist
+	Stat(ctx context.Context, objectName string) (*ObjectInfo, error)
+
 	// Delete removes a file (useful for rollbacks)
 	Delete(ctx context.Context, objectName string) error
 
-	// (optional) PresignedURL generates a temporary public link
-	// PresignedURL(ctx context.Context, objectName string) (string, error)
+	// PresignedGetURL generates a temporary public link to download a file
+	PresignedGetURL(ctx context.Context, objectName string, ttl time.Duration) (string, error)
+
+	// List returns the files whose name starts with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
 }
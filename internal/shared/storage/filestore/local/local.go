@@ -0,0 +1,271 @@
+package local
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore"
+)
+
+// metaSuffix names the sidecar file holding an object's metadata
+const metaSuffix = ".meta.json"
+
+// Store keeps objects as plain files under a root directory, for running without MinIO
+type Store struct {
+	root string
+}
+
+var _ filestore.FileStore = (*Store)(nil)
+
+type metadata struct {
+	ContentType string `json:"contentType"`
+	ETag        string `json:"etag"`
+}
+
+// New initializes the root directory of the store
+func New(root string) (*Store, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage directory: %w", err)
+	}
+
+	if err := os.MkdirAll(absRoot, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	return &Store{root: absRoot}, nil
+}
+
+// resolve maps an object name to a path inside the root, rejecting anything that would escape it
+func (s *Store) resolve(objectName string) (string, error) {
+	if objectName == "" || strings.Contains(objectName, "\\") || strings.HasSuffix(objectName, metaSuffix) {
+		return "", fmt.Errorf("invalid object name: %q", objectName)
+	}
+
+	cleaned := path.Clean("/" + objectName)
+	if cleaned != "/"+objectName {
+		return "", fmt.Errorf("invalid object name: %q", objectName)
+	}
+
+	full := filepath.Join(s.root, filepath.FromSlash(cleaned))
+	if !strings.HasPrefix(full, s.root+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object name: %q", objectName)
+	}
+
+	return full, nil
+}
+
+// Upload writes to a temp file in the target directory and renames it into place,
+// so readers never see a partially written object
+func (s *Store) Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error {
+	full, err := s.resolve(objectName)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(full)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	hash := sha256.New()
+
+	err = writeAtomic(dir, full, func(w io.Writer) error {
+		written, err := io.Copy(io.MultiWriter(w, hash), reader)
+		if err != nil {
+			return err
+		}
+
+		if size >= 0 && written != size {
+			return fmt.Errorf("expected %d bytes, got %d", size, written)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	meta, err := json.Marshal(metadata{
+		ContentType: contentType,
+		ETag:        hex.EncodeToString(hash.Sum(nil)),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeAtomic(dir, full+metaSuffix, func(w io.Writer) error {
+		_, err := w.Write(meta)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write file metadata: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, objectName string) (*filestore.Object, error) {
+	full, err := s.resolve(objectName)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(full)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, filestore.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	return &filestore.Object{
+		ReadSeekCloser: file,
+		Info:           objectInfo(full, stat),
+	}, nil
+}
+
+func (s *Store) Stat(ctx context.Context, objectName string) (*filestore.ObjectInfo, error) {
+	full, err := s.resolve(objectName)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(full)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, filestore.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	info := objectInfo(full, stat)
+
+	return &info, nil
+}
+
+// objectInfo combines the file's stat with the metadata sidecar next to it
+func objectInfo(full string, stat fs.FileInfo) filestore.ObjectInfo {
+	// a missing sidecar only costs the content type
+	meta := metadata{ContentType: "application/octet-stream"}
+	if raw, err := os.ReadFile(full + metaSuffix); err == nil {
+		json.Unmarshal(raw, &meta)
+	}
+
+	return filestore.ObjectInfo{
+		Size:         stat.Size(),
+		ContentType:  meta.ContentType,
+		ETag:         meta.ETag,
+		LastModified: stat.ModTime(),
+	}
+}
+
+// Delete removes the object and its metadata, a missing object is not an error
+func (s *Store) Delete(ctx context.Context, objectName string) error {
+	full, err := s.resolve(objectName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(full); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	if err := os.Remove(full + metaSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete file metadata: %w", err)
+	}
+
+	return nil
+}
+
+// List walks the whole root, skipping metadata sidecars and unfinished uploads
+func (s *Store) List(ctx context.Context, prefix string) ([]filestore.ObjectInfo, error) {
+	var objects []filestore.ObjectInfo
+
+	err := filepath.WalkDir(s.root, func(full string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || strings.HasSuffix(full, metaSuffix) || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, full)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, filestore.ObjectInfo{
+			Name:         name,
+			Size:         stat.Size(),
+			LastModified: stat.ModTime(),
+		})
+
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	return objects, nil
+}
+
+func (s *Store) PresignedGetURL(ctx context.Context, objectName string, ttl time.Duration) (string, error) {
+	return "", filestore.ErrPresignNotSupported
+}
+
+func writeAtomic(dir, target string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	// a no-op once the rename succeeded
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
@@ -0,0 +1,167 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore"
+)
+
+func TestResolve(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		objectName string
+		want       string
+	}{
+		{"a.png", "a.png"},
+		{"profile-pics/1.png", "profile-pics/1.png"},
+		{"exports/1/2.zip", "exports/1/2.zip"},
+		{"..a.png", "..a.png"},
+		{"", ""},
+		{".", ""},
+		{"..", ""},
+		{"../secret", ""},
+		{"a/../../secret", ""},
+		{"a/../b", ""},
+		{"./a", ""},
+		{"a/./b", ""},
+		{"a//b", ""},
+		{"a/", ""},
+		{"/etc/passwd", ""},
+		{"..\\secret", ""},
+		{"a\\b", ""},
+		// the metadata sidecars are not objects of their own
+		{"a.png.meta.json", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.objectName, func(t *testing.T) {
+			got, err := s.resolve(tt.objectName)
+
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("expected %q to be rejected, got %s", tt.objectName, got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := filepath.Join(s.root, filepath.FromSlash(tt.want)); got != want {
+				t.Fatalf("resolve(%q) = %s, want %s", tt.objectName, got, want)
+			}
+		})
+	}
+}
+
+func TestStoreRejectsEscapingNames(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+
+	s, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a file right next to the root, which no object name may reach
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, "../secret"); err == nil {
+		t.Fatal("expected Get to reject a name outside the root")
+	}
+
+	if _, err := s.Stat(ctx, "../secret"); err == nil {
+		t.Fatal("expected Stat to reject a name outside the root")
+	}
+
+	if err := s.Delete(ctx, "../secret"); err == nil {
+		t.Fatal("expected Delete to reject a name outside the root")
+	}
+
+	if err := s.Upload(ctx, "../secret", strings.NewReader("overwritten"), -1, "text/plain"); err == nil {
+		t.Fatal("expected Upload to reject a name outside the root")
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(dir, "secret")); string(content) != "secret" {
+		t.Fatalf("the file outside the root was changed to %q", content)
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if err := s.Upload(ctx, "profile-pics/1.png", strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a size that does not match is an incomplete upload
+	if err := s.Upload(ctx, "profile-pics/2.png", strings.NewReader("png"), 4, "image/png"); err == nil {
+		t.Fatal("expected an upload of the wrong size to fail")
+	}
+
+	info, err := s.Stat(ctx, "profile-pics/1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size != 3 || info.ContentType != "image/png" || info.ETag == "" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	obj, err := s.Get(ctx, "profile-pics/1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil || string(content) != "png" {
+		t.Fatalf("unexpected content %q, %v", content, err)
+	}
+
+	objects, err := s.List(ctx, "profile-pics/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(objects) != 1 || objects[0].Name != "profile-pics/1.png" {
+		t.Fatalf("expected only the uploaded object to be listed, got %+v", objects)
+	}
+
+	if err := s.Delete(ctx, "profile-pics/1.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Stat(ctx, "profile-pics/1.png"); !errors.Is(err, filestore.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after the delete, got %v", err)
+	}
+
+	if _, err := s.Get(ctx, "profile-pics/1.png"); !errors.Is(err, filestore.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after the delete, got %v", err)
+	}
+
+	// deleting what is gone already is not an error
+	if err := s.Delete(ctx, "profile-pics/1.png"); err != nil {
+		t.Fatal(err)
+	}
+}
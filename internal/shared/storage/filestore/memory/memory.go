@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore"
+)
+
+type object struct {
+	data         []byte
+	contentType  string
+	etag         string
+	lastModified time.Time
+}
+
+// Store keeps objects in process memory, for tests
+type Store struct {
+	mu      sync.RWMutex
+	objects map[string]object
+}
+
+var _ filestore.FileStore = (*Store)(nil)
+
+func New() *Store {
+	return &Store{objects: make(map[string]object)}
+}
+
+func (s *Store) Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[objectName] = object{
+		data:         data,
+		contentType:  contentType,
+		etag:         hex.EncodeToString(sum[:]),
+		lastModified: time.Now(),
+	}
+
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, objectName string) (*filestore.Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[objectName]
+	if !ok {
+		return nil, filestore.ErrNotFound
+	}
+
+	return &filestore.Object{
+		ReadSeekCloser: nopCloser{bytes.NewReader(obj.data)},
+		Info: filestore.ObjectInfo{
+			Size:         int64(len(obj.data)),
+			ContentType:  obj.contentType,
+			ETag:         obj.etag,
+			LastModified: obj.lastModified,
+		},
+	}, nil
+}
+
+func (s *Store) Stat(ctx context.Context, objectName string) (*filestore.ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[objectName]
+	if !ok {
+		return nil, filestore.ErrNotFound
+	}
+
+	return &filestore.ObjectInfo{
+		Size:         int64(len(obj.data)),
+		ContentType:  obj.contentType,
+		ETag:         obj.etag,
+		LastModified: obj.lastModified,
+	}, nil
+}
+
+func (s *Store) Delete(ctx context.Context, objectName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, objectName)
+	return nil
+}
+
+func (s *Store) List(ctx context.Context, prefix string) ([]filestore.ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var objects []filestore.ObjectInfo
+
+	for name, obj := range s.objects {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		objects = append(objects, filestore.ObjectInfo{
+			Name:         name,
+			Size:         int64(len(obj.data)),
+			ContentType:  obj.contentType,
+			ETag:         obj.etag,
+			LastModified: obj.lastModified,
+		})
+	}
+
+	return objects, nil
+}
+
+func (s *Store) PresignedGetURL(ctx context.Context, objectName string, ttl time.Duration) (string, error) {
+	return "", filestore.ErrPresignNotSupported
+}
+
+// Names lists the stored object names, for assertions in tests
+func (s *Store) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.objects))
+	for name := range s.objects {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"time"
 
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore"
 	"github.com/minio/minio-go/v7"
@@ -62,6 +63,83 @@ func (c *Client) Upload(ctx context.Context, objectName string, reader io.Reader
 	return nil
 }
 
+func (c *Client) Get(ctx context.Context, objectName string) (*filestore.Object, error) {
+	obj, err := c.minioClient.GetObject(ctx, c.bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	// GetObject is lazy, Stat is the first call that reaches the server
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, filestore.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	return &filestore.Object{
+		ReadSeekCloser: obj,
+		Info: filestore.ObjectInfo{
+			Size:         info.Size,
+			ContentType:  info.ContentType,
+			ETag:         info.ETag,
+			LastModified: info.LastModified,
+		},
+	}, nil
+}
+
+func (c *Client) Stat(ctx context.Context, objectName string) (*filestore.ObjectInfo, error) {
+	info, err := c.minioClient.StatObject(ctx, c.bucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, filestore.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	return &filestore.ObjectInfo{
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+// PresignedGetURL returns a link that downloads the object without credentials until ttl runs out
+func (c *Client) PresignedGetURL(ctx context.Context, objectName string, ttl time.Duration) (string, error) {
+	u, err := c.minioClient.PresignedGetObject(ctx, c.bucketName, objectName, ttl, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign download: %w", err)
+	}
+
+	return u.String(), nil
+}
+
+func (c *Client) List(ctx context.Context, prefix string) ([]filestore.ObjectInfo, error) {
+	var objects []filestore.ObjectInfo
+
+	for info := range c.minioClient.ListObjects(ctx, c.bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", info.Err)
+		}
+
+		objects = append(objects, filestore.ObjectInfo{
+			Name:         info.Key,
+			Size:         info.Size,
+			ContentType:  info.ContentType,
+			ETag:         info.ETag,
+			LastModified: info.LastModified,
+		})
+	}
+
+	return objects, nil
+}
+
 func (c *Client) Delete(ctx context.Context, objectName string) error {
 	return c.minioClient.RemoveObject(ctx, c.bucketName, objectName, minio.RemoveObjectOptions{})
 }
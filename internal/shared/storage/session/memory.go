@@ -0,0 +1,125 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/config"
+	"github.com/gorilla/sessions"
+)
+
+// NewMemoryStore keeps sessions in process memory. Sessions are lost on restart
+// and not shared between instances, so it is only meant for tests and local runs.
+func NewMemoryStore(cfg *config.Config) (*Store, error) {
+	maxAgeDuration, err := time.ParseDuration(cfg.Cookies.Session.Expiry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session expiry format: %w", err)
+	}
+
+	store := &memoryStore{
+		sessions: make(map[string]memorySession),
+		options: sessions.Options{
+			Path:     cfg.Cookies.Session.Path,
+			MaxAge:   int(maxAgeDuration.Seconds()),
+			HttpOnly: true,
+			Secure:   cfg.Cookies.Session.Secure,
+			SameSite: http.SameSiteLaxMode,
+		},
+	}
+
+	return &Store{
+		inner:      store,
+		cookieName: cfg.Cookies.Session.Name,
+	}, nil
+}
+
+type memorySession struct {
+	values    map[interface{}]interface{}
+	expiresAt time.Time
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+	options  sessions.Options
+}
+
+func (s *memoryStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+func (s *memoryStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := s.options
+	session.Options = &opts
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.sessions[cookie.Value]
+	if !ok || time.Now().After(stored.expiresAt) {
+		delete(s.sessions, cookie.Value)
+		return session, nil
+	}
+
+	session.ID = cookie.Value
+	session.IsNew = false
+	for k, v := range stored.values {
+		session.Values[k] = v
+	}
+
+	return session, nil
+}
+
+func (s *memoryStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// MaxAge <= 0 deletes the session, mirroring the other stores
+	if session.Options.MaxAge <= 0 {
+		delete(s.sessions, session.ID)
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		id, err := newSessionId()
+		if err != nil {
+			return err
+		}
+		session.ID = id
+	}
+
+	values := make(map[interface{}]interface{}, len(session.Values))
+	for k, v := range session.Values {
+		values[k] = v
+	}
+
+	s.sessions[session.ID] = memorySession{
+		values:    values,
+		expiresAt: time.Now().Add(time.Duration(session.Options.MaxAge) * time.Second),
+	}
+
+	http.SetCookie(w, sessions.NewCookie(session.Name(), session.ID, session.Options))
+	return nil
+}
+
+func newSessionId() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(b), "="), nil
+}
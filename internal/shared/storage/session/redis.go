@@ -12,13 +12,7 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-func NewRedisStore(cfg *config.Config) (*Store, error) {
-
-	client := redis.NewClient(&redis.Options{
-		Addr:     cfg.Redis.Addr,
-		Password: cfg.Redis.Password,
-		DB:       cfg.Redis.DB,
-	})
+func NewRedisStore(client *redis.Client, cfg *config.Config) (*Store, error) {
 
 	store, err := redisstore.NewRedisStore(context.Background(), client)
 	if err != nil {
@@ -1,10 +1,17 @@
 package types
 
-import "encoding/gob"
+import (
+	"encoding/gob"
+	"time"
+)
 
 type UserSession struct {
-	UserID int64
-	Role   string
+	UserID     int64
+	Role       string
+	IsVerified bool
+	// SessionVersion must match the user's current version, bumping it revokes all sessions
+	SessionVersion int
+	IssuedAt       time.Time
 }
 
 // RegisterTypes ensures 'gob' knows how to encode this struct.
@@ -0,0 +1,196 @@
+// Package testutil wires the whole API against in-memory dependencies,
+// so it can be exercised end to end without Postgres, Redis, MinIO or SMTP.
+package testutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/admin"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/audit"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/auth"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/export"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/config"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/mailer"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/signedtoken"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore/memory"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/session"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/txn"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/types"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/user"
+)
+
+// Server is a running API backed by in-memory stores
+type Server struct {
+	*httptest.Server
+	Mailbox   *mailer.MemoryMailer
+	FileStore *memory.Store
+	// Sweeper has no minimum age, so every unreferenced object is swept
+	Sweeper *user.Sweeper
+	// Purger is not running, callers trigger it with PurgeDue
+	Purger *user.Purger
+	// ExportWorker is not running either, callers trigger it with ProcessDue
+	ExportWorker *export.Worker
+
+	users userRepository
+}
+
+// SetRole changes the role of the user with the email, e.g. to promote an admin
+func (s *Server) SetRole(ctx context.Context, email, role string) error {
+	u, err := s.users.FindByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	return s.users.UpdateRole(ctx, u.Id, role)
+}
+
+// Config returns the settings the in-memory server runs with
+func Config(publicURL string) *config.Config {
+	cfg := &config.Config{Env: "test"}
+
+	cfg.HTTPServer.PublicURL = publicURL
+
+	cfg.Cookies.Refresh = config.RefreshCookie{Name: "refresh", Path: "/", Expiry: "72h"}
+	cfg.Cookies.Session = config.SessionCookie{Name: "session", SecretKey: "test-session-secret", Path: "/", Expiry: "30m"}
+
+	cfg.Auth = config.Auth{
+		TokenSecret:                "test-token-secret",
+		VerificationExpiry:         "24h",
+		VerificationResendCooldown: "1m",
+		PasswordResetUrl:           publicURL + "/reset-password",
+		PasswordResetExpiry:        "15m",
+		PasswordResetCooldown:      "1m",
+		PasswordChangeUrl:          publicURL + "/change-password",
+		PasswordChangeExpiry:       "15m",
+		PasswordChangeCooldown:     "1m",
+		EmailChangeExpiry:          "24h",
+		EmailChangeCooldown:        "0s",
+	}
+
+	// short enough for the e2e runner to wait out
+	cfg.Account = config.Account{
+		DeletionGracePeriod: "1s",
+		PurgeInterval:       "1h",
+	}
+
+	// small enough for the e2e runner to exercise both the inline and the queued export
+	cfg.Export = config.Export{
+		SyncLimit:    512 * 1024,
+		Expiry:       "24h",
+		PollInterval: "1h",
+	}
+
+	return cfg
+}
+
+// NewServer starts the API on a random local port, callers must Close it
+func NewServer() (*Server, error) {
+	ts := httptest.NewUnstartedServer(nil)
+	cfg := Config("http://" + ts.Listener.Addr().String())
+
+	mailbox := mailer.NewMemoryMailer()
+	fileStore := memory.New()
+	userRepo := user.NewMemoryRepository()
+
+	handler, exportWorker, purger, err := newHandler(cfg, mailbox, fileStore, userRepo)
+	if err != nil {
+		ts.Close()
+		return nil, err
+	}
+
+	ts.Config.Handler = handler
+	ts.Start()
+
+	return &Server{
+		Server:       ts,
+		Mailbox:      mailbox,
+		FileStore:    fileStore,
+		Sweeper:      user.NewSweeper(userRepo, fileStore, "profile-pics/", 0),
+		Purger:       purger,
+		ExportWorker: exportWorker,
+		users:        userRepo,
+	}, nil
+}
+
+// userRepository is everything the handlers need from the in-memory user repository
+type userRepository interface {
+	auth.Repository
+	auth.PermissionFinder
+	user.Repository
+	user.PurgeRepository
+	admin.UserRepository
+}
+
+func newHandler(cfg *config.Config, mailbox *mailer.MemoryMailer, fileStore *memory.Store, userRepo userRepository) (http.Handler, *export.Worker, *user.Purger, error) {
+	types.RegisterTypes()
+
+	deletionGracePeriod, err := time.ParseDuration(cfg.Account.DeletionGracePeriod)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	store, err := session.NewMemoryStore(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	mailTemplates, err := mailer.LoadTemplates()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// emails are delivered synchronously, there is no outbox to drain
+	notifier := mailer.NewNotifier(mailbox, mailTemplates)
+
+	mainMux := http.NewServeMux()
+
+	profilePicApiPrefix := "api/user"
+
+	authRepo := auth.NewMemoryRepository()
+	tokenOpts := auth.TokenOptions{
+		VerifyEmailUrl:         cfg.PublicURL + "/api/auth/verify-email",
+		VerificationExpiry:     24 * time.Hour,
+		VerificationCooldown:   time.Minute,
+		ResetPasswordUrl:       cfg.Auth.PasswordResetUrl,
+		ResetPasswordExpiry:    15 * time.Minute,
+		ResetPasswordCooldown:  time.Minute,
+		ChangePasswordUrl:      cfg.Auth.PasswordChangeUrl,
+		ChangePasswordExpiry:   15 * time.Minute,
+		ChangePasswordCooldown: time.Minute,
+		ConfirmEmailChangeUrl:  cfg.PublicURL + "/api/auth/email/change/confirm",
+		CancelEmailChangeUrl:   cfg.PublicURL + "/api/auth/email/change/cancel",
+		ChangeEmailExpiry:      24 * time.Hour,
+		// lets the e2e runner stage several changes in a row
+		ChangeEmailCooldown: 0,
+	}
+	// few free attempts and short delays, for the e2e runner to get throttled and wait it out
+	loginThrottle := auth.NewLoginThrottle(auth.NewMemoryAttemptStore(), auth.ThrottleOptions{
+		AccountFreeAttempts: 3,
+		IpFreeAttempts:      20,
+		BaseDelay:           time.Second,
+		MaxDelay:            4 * time.Second,
+		Window:              time.Minute,
+	})
+	authService := auth.NewService(fileStore, userRepo, authRepo, txn.NoopTransactor{}, notifier, signedtoken.New(cfg.Auth.TokenSecret), tokenOpts, "profile-pics", deletionGracePeriod, loginThrottle)
+	authMiddleware := auth.NewMiddleware(store, userRepo, userRepo, cfg.Auth.RequireVerifiedEmail)
+	authHandler := auth.NewHandler(authService, store, authMiddleware, cfg.Cookies.Refresh.Name, cfg.Cookies.Refresh.Path, cfg.Refresh.Expiry, cfg.Cookies.Refresh.Secure, profilePicApiPrefix)
+	mainMux.Handle("/api/auth/", http.StripPrefix("/api/auth", authHandler.RegisterRoutes()))
+
+	userService := user.NewService(userRepo, fileStore, "profile-pics")
+	userHandler := user.NewHandler(userService, authMiddleware.AuthMiddleware, userRepo, fileStore, false, 15*time.Minute, profilePicApiPrefix)
+	mainMux.Handle("/api/user/", http.StripPrefix("/api/user", userHandler.RegisterRoutes()))
+	authHandler.RegisterAccountRoutes(mainMux, "/api/user")
+
+	auditRepo := audit.NewMemoryRepository()
+
+	exportService := export.NewService(export.NewMemoryRepository(), userRepo, authRepo, auditRepo, fileStore, cfg.Export.SyncLimit, 24*time.Hour)
+	export.NewHandler(exportService, authMiddleware.AuthMiddleware).RegisterRoutes(mainMux, "/api/user")
+
+	adminService := admin.NewService(userRepo, authRepo, auditRepo, txn.NoopTransactor{})
+	mainMux.Handle("/api/admin/", http.StripPrefix("/api/admin", admin.NewHandler(adminService, authMiddleware).RegisterRoutes()))
+
+	return mainMux, export.NewWorker(exportService, time.Hour), user.NewPurger(userRepo, fileStore, exportService, time.Hour), nil
+}
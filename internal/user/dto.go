@@ -1,5 +1,7 @@
 package user
 
+import "time"
+
 type ProfileResponse struct {
 	Id         int64  `json:"id"`
 	Email      string `json:"email"`
@@ -7,4 +9,16 @@ type ProfileResponse struct {
 	IsVerified bool   `json:"isVerified"`
 	FullName   string `json:"fullName"`
 	ProfilePic string `json:"profilePic"`
+	// PendingEmail is set while an email change waits for confirmation
+	PendingEmail *string `json:"pendingEmail,omitempty"`
+}
+
+type ProfilePicUrlResponse struct {
+	Url       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// UpdateProfileRequest is a partial update, omitted fields are left unchanged
+type UpdateProfileRequest struct {
+	FullName *string `json:"fullName" validate:"omitempty,min=1,max=100"`
 }
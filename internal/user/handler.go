@@ -1,29 +1,64 @@
 package user
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/checkimage"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/imageproc"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/response"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore"
 	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/types"
+	"github.com/go-playground/validator/v10"
 )
 
 type Repository interface {
 	FindById(ctx context.Context, id int64) (*User, error)
+	UpdateProfile(ctx context.Context, id int64, fullName string) error
+	ReplaceProfilePic(ctx context.Context, id int64, profilePicName string) (string, error)
+}
+
+type FileStore interface {
+	Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, objectName string) (*filestore.Object, error)
+	Stat(ctx context.Context, objectName string) (*filestore.ObjectInfo, error)
+	Delete(ctx context.Context, objectName string) error
+	PresignedGetURL(ctx context.Context, objectName string, ttl time.Duration) (string, error)
+}
+
+type Service interface {
+	UpdateProfile(ctx context.Context, id int64, in UpdateProfileInput) (*User, error)
+	ReplaceProfilePic(ctx context.Context, id int64, file io.Reader) (*User, error)
 }
 
 type Handler struct {
-	requireAuth      func(http.HandlerFunc) http.HandlerFunc
-	repo             Repository
-	profileApiPrefix string
+	service            Service
+	requireAuth        func(http.HandlerFunc) http.HandlerFunc
+	repo               Repository
+	fileStore          FileStore
+	presignProfilePics bool
+	presignedUrlExpiry time.Duration
+	profileApiPrefix   string
 }
 
-func NewHandler(requireAuth func(http.HandlerFunc) http.HandlerFunc, repo Repository, profileApiPrefix string) *Handler {
+func NewHandler(s Service, requireAuth func(http.HandlerFunc) http.HandlerFunc, repo Repository, fs FileStore, presignProfilePics bool, presignedUrlExpiry time.Duration, profileApiPrefix string) *Handler {
 	return &Handler{
-		requireAuth:      requireAuth,
-		repo:             repo,
-		profileApiPrefix: profileApiPrefix,
+		service:            s,
+		requireAuth:        requireAuth,
+		repo:               repo,
+		fileStore:          fs,
+		presignProfilePics: presignProfilePics,
+		presignedUrlExpiry: presignedUrlExpiry,
+		profileApiPrefix:   profileApiPrefix,
 	}
 }
 
@@ -53,22 +88,393 @@ func (h *Handler) Profile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// construct profile pic url
+	response.Retrived(w, "user", h.profileResponse(r, user))
+}
+
+// UpdateProfile applies a partial update of the editable profile fields
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	u, ok := GetUserFromContext(r.Context())
+
+	if !ok {
+		response.HandleInternalError(w, "Error retriving user from session")
+		return
+	}
+
+	var req UpdateProfileRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if errors.Is(err, io.EOF) {
+		response.HandleBadRequest(w, "empty body")
+		return
+	}
+
+	if err != nil {
+		response.HandleBadRequest(w, err.Error())
+		return
+	}
+
+	if req.FullName != nil {
+		trimmed := strings.TrimSpace(*req.FullName)
+		req.FullName = &trimmed
+	}
+
+	if err := validator.New().Struct(req); err != nil {
+		response.HandleValidationErrors(w, err)
+		return
+	}
+
+	if req.FullName == nil {
+		response.HandleBadRequest(w, "no fields to update")
+		return
+	}
+
+	user, err := h.service.UpdateProfile(r.Context(), u.UserID, UpdateProfileInput{
+		FullName: req.FullName,
+	})
+
+	if err != nil {
+		response.HandleInternalError(w, "Error while updating profile")
+		return
+	}
+
+	response.Updated(w, "user", h.profileResponse(r, user))
+}
+
+// ReplaceProfilePic takes a multipart upload in the "profilePic" field
+func (h *Handler) ReplaceProfilePic(w http.ResponseWriter, r *http.Request) {
+	u, ok := GetUserFromContext(r.Context())
+
+	if !ok {
+		response.HandleInternalError(w, "Error retriving user from session")
+		return
+	}
+
+	// the picture plus some room for the multipart framing
+	r.Body = http.MaxBytesReader(w, r.Body, imageproc.MaxFileSize+1<<20)
+
+	file, header, err := r.FormFile("profilePic")
+
+	if err != nil {
+		response.HandleBadRequest(w, "Profile picture is required")
+		return
+	}
+
+	defer file.Close()
+
+	// check file if image, the client's Content-Type and file name are not trusted
+	if header.Size > imageproc.MaxFileSize {
+		response.HandlePayloadTooLarge(w, "Profile picture is too large")
+		return
+	}
+
+	if _, err = checkimage.CheckImage(file); err != nil {
+		if errors.Is(err, imageproc.ErrTooLarge) {
+			response.HandlePayloadTooLarge(w, "Profile picture dimensions are too large")
+			return
+		}
+
+		response.HandleBadRequest(w, "Profile picture should be a jpg, png, gif or webp image")
+		return
+	}
+
+	user, err := h.service.ReplaceProfilePic(r.Context(), u.UserID, file)
+
+	if err != nil {
+		if errors.Is(err, imageproc.ErrInvalidImage) {
+			response.HandleBadRequest(w, "Profile picture could not be read as an image")
+			return
+		}
+
+		if errors.Is(err, imageproc.ErrTooLarge) {
+			response.HandlePayloadTooLarge(w, "Profile picture is too large")
+			return
+		}
+
+		response.HandleInternalError(w, "Error while replacing profile picture")
+		return
+	}
+
+	response.Updated(w, "user", h.profileResponse(r, user))
+}
+
+// requestOrigin is the scheme and host the request was sent to
+func requestOrigin(r *http.Request) string {
 	protocol := "http"
 	if r.TLS != nil {
 		protocol = "https"
 	}
 
-	profilePicUrl := fmt.Sprintf("%s://%s/%s/%s", protocol, r.Host, h.profileApiPrefix, "profile-pic")
+	return protocol + "://" + r.Host
+}
+
+func (h *Handler) profileResponse(r *http.Request, user *User) ProfileResponse {
+	// construct profile pic url
+	profilePicUrl := fmt.Sprintf("%s/%s/%s", requestOrigin(r), h.profileApiPrefix, "profile-pic")
+
+	return ProfileResponse{
+		Id:           user.Id,
+		Email:        user.Email,
+		FullName:     user.FullName,
+		ProfilePic:   profilePicUrl,
+		Role:         user.Role,
+		IsVerified:   user.IsVerified,
+		PendingEmail: user.PendingEmail,
+	}
+}
+
+// ProfilePic streams the caller's own profile picture
+func (h *Handler) ProfilePic(w http.ResponseWriter, r *http.Request) {
+	u, ok := GetUserFromContext(r.Context())
+
+	if !ok {
+		response.HandleInternalError(w, "Error retriving user from session")
+		return
+	}
+
+	// the url stays the same when the picture is replaced, so browsers must revalidate
+	h.serveProfilePic(w, r, u.UserID, "private, no-cache")
+}
+
+// PublicProfilePic streams any user's profile picture, used as a public avatar
+func (h *Handler) PublicProfilePic(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+
+	if err != nil {
+		response.HandleBadRequest(w, "Invalid user id")
+		return
+	}
+
+	h.serveProfilePic(w, r, id, "public, max-age=300")
+}
+
+// ProfilePicUrl hands out a short-lived presigned link to the caller's profile picture
+func (h *Handler) ProfilePicUrl(w http.ResponseWriter, r *http.Request) {
+	u, ok := GetUserFromContext(r.Context())
+
+	if !ok {
+		response.HandleInternalError(w, "Error retriving user from session")
+		return
+	}
+
+	size, ok := profilePicSize(w, r)
+
+	if !ok {
+		return
+	}
+
+	user, ok := h.findProfilePicOwner(w, r, u.UserID)
+
+	if !ok {
+		return
+	}
+
+	expiresAt := time.Now().Add(h.presignedUrlExpiry)
+
+	// the public endpoint serves what cannot be signed: a default avatar, which is not
+	// stored anywhere, and pictures in a store without presigned urls
+	publicUrl := ProfilePicUrlResponse{
+		Url:       fmt.Sprintf("%s/%s/users/%d/profile-pic?size=%s", requestOrigin(r), h.profileApiPrefix, user.Id, size),
+		ExpiresAt: expiresAt,
+	}
+
+	if user.ProfilePicName == "" {
+		response.Retrived(w, "profile picture url", publicUrl)
+		return
+	}
+
+	objectName, err := h.findProfilePic(r.Context(), user, size)
+
+	if err != nil {
+		if errors.Is(err, filestore.ErrNotFound) {
+			response.HandleNotFound(w, "Profile picture not found")
+			return
+		}
+
+		response.HandleInternalError(w, "Error retriving profile picture")
+		return
+	}
+
+	url, err := h.fileStore.PresignedGetURL(r.Context(), objectName, h.presignedUrlExpiry)
+
+	if errors.Is(err, filestore.ErrPresignNotSupported) {
+		response.Retrived(w, "profile picture url", publicUrl)
+		return
+	}
+
+	if err != nil {
+		response.HandleInternalError(w, "Error while generating profile picture url")
+		return
+	}
+
+	response.Retrived(w, "profile picture url", ProfilePicUrlResponse{
+		Url:       url,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// findProfilePicOwner loads the user whose picture is requested, writing a 404 if there is none
+func (h *Handler) findProfilePicOwner(w http.ResponseWriter, r *http.Request, userId int64) (*User, bool) {
+	user, err := h.repo.FindById(r.Context(), userId)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.HandleNotFound(w, "User not found")
+			return nil, false
+		}
+
+		response.HandleInternalError(w, "Error retriving user from db")
+		return nil, false
+	}
+
+	// an account waiting to be purged is already gone for everyone else
+	if user.DeletedAt != nil {
+		response.HandleNotFound(w, "User not found")
+		return nil, false
+	}
 
-	resData := ProfileResponse{
-		Id:         user.Id,
-		Email:      user.Email,
-		FullName:   user.FullName,
-		ProfilePic: profilePicUrl,
-		Role:       user.Role,
-		IsVerified: user.IsVerified,
+	return user, true
+}
+
+// profilePicSize reads the optional ?size= query param, writing a 400 for an unknown size
+func profilePicSize(w http.ResponseWriter, r *http.Request) (string, bool) {
+	size := r.URL.Query().Get("size")
+
+	if size == "" {
+		return imageproc.SizeOriginal, true
+	}
+
+	if !imageproc.IsSize(size) {
+		response.HandleBadRequest(w, "size must be one of "+strings.Join(imageproc.Sizes(), ", "))
+		return "", false
+	}
+
+	return size, true
+}
+
+func (h *Handler) serveProfilePic(w http.ResponseWriter, r *http.Request, userId int64, cacheControl string) {
+	size, ok := profilePicSize(w, r)
+
+	if !ok {
+		return
 	}
 
-	response.Retrived(w, "user", resData)
+	user, ok := h.findProfilePicOwner(w, r, userId)
+
+	if !ok {
+		return
+	}
+
+	if user.ProfilePicName == "" {
+		h.serveDefaultAvatar(w, r, user, size, cacheControl)
+		return
+	}
+
+	if h.presignProfilePics {
+		objectName, err := h.findProfilePic(r.Context(), user, size)
+
+		if err != nil {
+			if errors.Is(err, filestore.ErrNotFound) {
+				response.HandleNotFound(w, "Profile picture not found")
+				return
+			}
+
+			response.HandleInternalError(w, "Error retriving profile picture")
+			return
+		}
+
+		url, err := h.fileStore.PresignedGetURL(r.Context(), objectName, h.presignedUrlExpiry)
+
+		// a store that cannot sign falls through to serving the picture itself
+		if err != nil && !errors.Is(err, filestore.ErrPresignNotSupported) {
+			response.HandleInternalError(w, "Error while generating profile picture url")
+			return
+		}
+
+		if err == nil {
+			// the redirect must not outlive the signature it points to
+			w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(h.presignedUrlExpiry.Seconds()/2)))
+			http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+			return
+		}
+	}
+
+	obj, err := h.openProfilePic(r.Context(), user, size)
+
+	if err != nil {
+		if errors.Is(err, filestore.ErrNotFound) {
+			response.HandleNotFound(w, "Profile picture not found")
+			return
+		}
+
+		response.HandleInternalError(w, "Error retriving profile picture")
+		return
+	}
+
+	defer obj.Close()
+
+	w.Header().Set("Content-Type", obj.Info.ContentType)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if obj.Info.ETag != "" {
+		w.Header().Set("ETag", strconv.Quote(obj.Info.ETag))
+	}
+
+	// ServeContent takes care of Range, If-None-Match and If-Modified-Since
+	http.ServeContent(w, r, "", obj.Info.LastModified, obj)
+}
+
+// findProfilePic returns the object name of the stored variant of the user's picture.
+// Pictures uploaded before resizing was introduced only exist in their original size,
+// which is returned instead.
+func (h *Handler) findProfilePic(ctx context.Context, user *User, size string) (string, error) {
+	objectName := imageproc.ObjectName(user.ProfilePicName, size)
+
+	_, err := h.fileStore.Stat(ctx, objectName)
+
+	if errors.Is(err, filestore.ErrNotFound) && objectName != user.ProfilePicName {
+		objectName = user.ProfilePicName
+		_, err = h.fileStore.Stat(ctx, objectName)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return objectName, nil
+}
+
+// openProfilePic opens the stored variant of the user's picture, falling back to the
+// original like findProfilePic does
+func (h *Handler) openProfilePic(ctx context.Context, user *User, size string) (*filestore.Object, error) {
+	objectName := imageproc.ObjectName(user.ProfilePicName, size)
+
+	obj, err := h.fileStore.Get(ctx, objectName)
+
+	if errors.Is(err, filestore.ErrNotFound) && objectName != user.ProfilePicName {
+		obj, err = h.fileStore.Get(ctx, user.ProfilePicName)
+	}
+
+	return obj, err
+}
+
+// serveDefaultAvatar renders the identicon of a user without a profile picture.
+// It only depends on the user id, so it is the same on every request and instance.
+func (h *Handler) serveDefaultAvatar(w http.ResponseWriter, r *http.Request, user *User, size string, cacheControl string) {
+	seed := strconv.FormatInt(user.Id, 10)
+
+	avatar, err := imageproc.Identicon(seed, imageproc.Dimension(size))
+
+	if err != nil {
+		response.HandleInternalError(w, "Error while generating default avatar")
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", strconv.Quote(fmt.Sprintf("identicon-%s-%s", seed, size)))
+
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(avatar))
 }
@@ -0,0 +1,338 @@
+package user
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryRepository is an in-memory stand-in for repository, for tests.
+// It returns the same errors as the postgres one, e.g. sql.ErrNoRows.
+type memoryRepository struct {
+	mu     sync.RWMutex
+	nextId int64
+	users  map[int64]User
+	// rolePermissions stands in for the roles and role_permissions tables
+	rolePermissions map[string][]string
+}
+
+func NewMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		nextId: 1,
+		users:  make(map[int64]User),
+		// the rows seeded by the roles and permissions migration
+		rolePermissions: map[string][]string{
+			RoleUser:  nil,
+			RoleAdmin: {PermissionAuditRead, PermissionUsersDelete, PermissionUsersRead, PermissionUsersWrite},
+		},
+	}
+}
+
+func (r *memoryRepository) Create(ctx context.Context, u User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Email == u.Email {
+			return ErrEmailConflict
+		}
+	}
+
+	u.Id = r.nextId
+	u.Status = StatusActive
+	u.CreatedAt = u.UpdatedAt
+	r.users[u.Id] = u
+	r.nextId++
+
+	return nil
+}
+
+func (r *memoryRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (r *memoryRepository) FindById(ctx context.Context, id int64) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return &u, nil
+}
+
+func (r *memoryRepository) MarkVerified(ctx context.Context, id int64) error {
+	return r.update(id, func(u *User) {
+		u.IsVerified = true
+	})
+}
+
+func (r *memoryRepository) UpdatePassword(ctx context.Context, id int64, hash string) error {
+	return r.update(id, func(u *User) {
+		u.PasswordHash = hash
+	})
+}
+
+func (r *memoryRepository) RevokeSessions(ctx context.Context, id int64) (int, error) {
+	var version int
+
+	err := r.update(id, func(u *User) {
+		u.SessionVersion++
+		version = u.SessionVersion
+	})
+
+	return version, err
+}
+
+func (r *memoryRepository) ListProfilePicNames(ctx context.Context) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var names []string
+
+	for _, u := range r.users {
+		if u.ProfilePicName != "" {
+			names = append(names, u.ProfilePicName)
+		}
+	}
+
+	return names, nil
+}
+
+func (r *memoryRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	r.mu.RLock()
+	_, ok := r.rolePermissions[role]
+	r.mu.RUnlock()
+
+	if !ok {
+		return ErrUnknownRole
+	}
+
+	return r.update(id, func(u *User) {
+		u.Role = role
+	})
+}
+
+func (r *memoryRepository) ListRolePermissions(ctx context.Context, role string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Clone(r.rolePermissions[role]), nil
+}
+
+func (r *memoryRepository) UpdateProfile(ctx context.Context, id int64, fullName string) error {
+	return r.update(id, func(u *User) {
+		u.FullName = fullName
+	})
+}
+
+func (r *memoryRepository) ReplaceProfilePic(ctx context.Context, id int64, profilePicName string) (string, error) {
+	var old string
+
+	err := r.update(id, func(u *User) {
+		old = u.ProfilePicName
+		u.ProfilePicName = profilePicName
+	})
+
+	return old, err
+}
+
+func (r *memoryRepository) SetPendingEmail(ctx context.Context, id int64, email string) error {
+	return r.update(id, func(u *User) {
+		u.PendingEmail = &email
+	})
+}
+
+func (r *memoryRepository) ConfirmEmailChange(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.PendingEmail == nil {
+		return sql.ErrNoRows
+	}
+
+	for _, existing := range r.users {
+		if existing.Email == *u.PendingEmail {
+			return ErrEmailConflict
+		}
+	}
+
+	u.Email = *u.PendingEmail
+	u.PendingEmail = nil
+	u.IsVerified = true
+	u.UpdatedAt = time.Now()
+	r.users[id] = u
+
+	return nil
+}
+
+func (r *memoryRepository) ClearPendingEmail(ctx context.Context, id int64) error {
+	return r.update(id, func(u *User) {
+		u.PendingEmail = nil
+	})
+}
+
+func (r *memoryRepository) SoftDelete(ctx context.Context, id int64, purgeAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	now := time.Now()
+	u.Status = StatusPendingDeletion
+	u.StatusReason = nil
+	u.StatusUntil = nil
+	u.DeletedAt = &now
+	u.PurgeAt = &purgeAt
+	u.SessionVersion++
+	u.UpdatedAt = now
+	r.users[id] = u
+
+	return nil
+}
+
+func (r *memoryRepository) RestoreAccount(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.PurgeAt == nil || !u.PurgeAt.After(time.Now()) {
+		return sql.ErrNoRows
+	}
+
+	u.Status = StatusActive
+	u.DeletedAt = nil
+	u.PurgeAt = nil
+	u.UpdatedAt = time.Now()
+	r.users[id] = u
+
+	return nil
+}
+
+func (r *memoryRepository) ListPurgeable(ctx context.Context, limit int) ([]User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []User
+
+	for _, u := range r.users {
+		if len(users) == limit {
+			break
+		}
+
+		if u.PurgeAt != nil && !u.PurgeAt.After(time.Now()) {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+func (r *memoryRepository) HardDelete(ctx context.Context, id int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.PurgeAt == nil || u.PurgeAt.After(time.Now()) {
+		return false, nil
+	}
+
+	delete(r.users, id)
+	return true, nil
+}
+
+func (r *memoryRepository) SetStatus(ctx context.Context, id int64, status string, reason *string, until *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	if status != StatusActive {
+		u.SessionVersion++
+	}
+
+	u.Status = status
+	u.StatusReason = reason
+	u.StatusUntil = until
+	u.UpdatedAt = time.Now()
+	r.users[id] = u
+
+	return nil
+}
+
+func (r *memoryRepository) Search(ctx context.Context, f Filter) ([]User, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	terms := strings.Fields(strings.ToLower(f.Query))
+
+	var matches []User
+
+	for _, u := range r.users {
+		if f.Role != "" && u.Role != f.Role ||
+			f.IsVerified != nil && u.IsVerified != *f.IsVerified ||
+			f.CreatedAfter != nil && u.CreatedAt.Before(*f.CreatedAfter) ||
+			f.CreatedBefore != nil && !u.CreatedAt.Before(*f.CreatedBefore) {
+			continue
+		}
+
+		// a plain substring match stands in for the full-text search
+		text := strings.ToLower(u.Email + " " + u.FullName)
+		if !slices.ContainsFunc(terms, func(term string) bool { return !strings.Contains(text, term) }) {
+			matches = append(matches, u)
+		}
+	}
+
+	slices.SortFunc(matches, func(a, b User) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(b.Id, a.Id)
+	})
+
+	total := len(matches)
+
+	start := min(f.Offset, total)
+	end := min(start+f.Limit, total)
+
+	return matches[start:end], total, nil
+}
+
+func (r *memoryRepository) update(id int64, fn func(u *User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	fn(&u)
+	u.UpdatedAt = time.Now()
+	r.users[id] = u
+
+	return nil
+}
@@ -2,23 +2,61 @@ package user
 
 import "time"
 
-// type UserRole string
+// Roles are rows of the roles table, these are the ones the code refers to
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
 
-// const (
-// 	RoleUser  UserRole = "user"
-// 	RoleAdmin UserRole = "admin"
-// )
+// Permissions are rows of the permissions table, granted to roles through role_permissions
+const (
+	PermissionUsersRead   = "users:read"
+	PermissionUsersWrite  = "users:write"
+	PermissionUsersDelete = "users:delete"
+	PermissionAuditRead   = "audit:read"
+)
+
+// Account states. A suspended or locked account cannot log in until an admin lifts it or its
+// StatusUntil passes, which a lock always has. An account pending deletion waits out its
+// grace period and is restored by logging in.
+const (
+	StatusActive          = "active"
+	StatusSuspended       = "suspended"
+	StatusLocked          = "locked"
+	StatusPendingDeletion = "pending_deletion"
+)
+
+// Filter narrows down Search, zero values match everything
+type Filter struct {
+	Role          string
+	IsVerified    *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Query is free text matched against the email and the full name
+	Query  string
+	Limit  int
+	Offset int
+}
 
 type User struct {
-	Id                 int64
-	Email              string
-	Role               string
-	PasswordHash       string
-	RefreshTokenHash   string
-	RefreshTokenExpiry time.Time
-	IsVerified         bool
-	FullName           string
-	ProfilePicName     string
-	CreatedAt          time.Time
-	UpdatedAt          time.Time
+	Id             int64
+	Email          string
+	Role           string
+	Status         string
+	PasswordHash   string
+	IsVerified     bool
+	FullName       string
+	ProfilePicName string
+	SessionVersion int
+	// StatusReason says why the account was suspended or locked, for admins only
+	StatusReason *string
+	// StatusUntil is when a suspension or lock ends by itself, nil for indefinitely
+	StatusUntil *time.Time
+	// PendingEmail is the address an email change waits to be confirmed by, nil without one
+	PendingEmail *string
+	// DeletedAt is set while a deleted account waits out its grace period until PurgeAt
+	DeletedAt *time.Time
+	PurgeAt   *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
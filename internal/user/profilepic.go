@@ -0,0 +1,62 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/imageproc"
+)
+
+// ProfilePicStore is the part of the file store needed to store profile pictures
+type ProfilePicStore interface {
+	Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error
+	Delete(ctx context.Context, objectName string) error
+}
+
+// UploadProfilePic stores the picture in every size of imageproc under dir and returns the name
+// of the original, the other sizes are found through imageproc.ObjectName
+func UploadProfilePic(ctx context.Context, fs ProfilePicStore, dir string, r io.Reader) (string, error) {
+	// one byte over the limit is enough for Process to reject the file
+	data, err := io.ReadAll(io.LimitReader(r, imageproc.MaxFileSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	processed, err := imageproc.Process(data)
+	if err != nil {
+		return "", err
+	}
+
+	// Generate unique object name: "profile-pics/timestamp.jpg"
+	profilePicName := fmt.Sprintf("%s/%d%s", dir, time.Now().UnixNano(), processed.Ext)
+
+	for _, v := range processed.Variants {
+		objectName := imageproc.ObjectName(profilePicName, v.Size)
+
+		// use context so if the user cancels the request, the upload cancels too.
+		err := fs.Upload(ctx, objectName, bytes.NewReader(v.Data), int64(len(v.Data)), processed.ContentType)
+		if err != nil {
+			DeleteProfilePic(ctx, fs, profilePicName)
+			return "", err
+		}
+	}
+
+	return profilePicName, nil
+}
+
+// DeleteProfilePic deletes every size of a picture that is no longer referenced.
+// It runs even if the request was cancelled, anything it misses is left to the orphan sweeper.
+func DeleteProfilePic(ctx context.Context, fs ProfilePicStore, profilePicName string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	for _, objectName := range imageproc.ObjectNames(profilePicName) {
+		if err := fs.Delete(ctx, objectName); err != nil {
+			log.Printf("failed to delete profile picture %s: %s", objectName, err)
+		}
+	}
+}
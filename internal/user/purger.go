@@ -0,0 +1,100 @@
+package user
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const purgeBatchSize = 50
+
+type PurgeRepository interface {
+	ListPurgeable(ctx context.Context, limit int) ([]User, error)
+	HardDelete(ctx context.Context, id int64) (bool, error)
+}
+
+// ExportDeleter removes the data exports of a user, archives included
+type ExportDeleter interface {
+	DeleteUserExports(ctx context.Context, userId int64) error
+}
+
+// Purger permanently deletes accounts whose deletion grace period is over,
+// including their profile pictures and data exports. Tokens go with the row
+// through ON DELETE CASCADE.
+type Purger struct {
+	repo      PurgeRepository
+	fileStore ProfilePicStore
+	exports   ExportDeleter
+	interval  time.Duration
+}
+
+func NewPurger(repo PurgeRepository, fs ProfilePicStore, exports ExportDeleter, interval time.Duration) *Purger {
+	return &Purger{
+		repo:      repo,
+		fileStore: fs,
+		exports:   exports,
+		interval:  interval,
+	}
+}
+
+// Run purges due accounts until ctx is cancelled
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.PurgeDue(context.WithoutCancel(ctx))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeDue deletes every account that is due and returns how many were deleted
+func (p *Purger) PurgeDue(ctx context.Context) int {
+	purged := 0
+
+	for {
+		users, err := p.repo.ListPurgeable(ctx, purgeBatchSize)
+		if err != nil {
+			log.Printf("purger: %s", err.Error())
+			return purged
+		}
+
+		deleted := 0
+
+		for _, u := range users {
+			ok, err := p.repo.HardDelete(ctx, u.Id)
+			if err != nil {
+				log.Printf("purger: failed to delete user %d: %s", u.Id, err.Error())
+				continue
+			}
+
+			// restored since it was listed
+			if !ok {
+				continue
+			}
+
+			// a failure here leaves an orphan for the sweeper, the account itself is gone
+			if u.ProfilePicName != "" {
+				DeleteProfilePic(ctx, p.fileStore, u.ProfilePicName)
+			}
+
+			if err := p.exports.DeleteUserExports(ctx, u.Id); err != nil {
+				log.Printf("purger: failed to delete the exports of user %d: %s", u.Id, err.Error())
+			}
+
+			deleted++
+		}
+
+		purged += deleted
+
+		// stop when the batch is drained or only held rows that could not be deleted
+		if len(users) < purgeBatchSize || deleted == 0 {
+			return purged
+		}
+	}
+}
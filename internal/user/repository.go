@@ -3,8 +3,28 @@ package user
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/txn"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrEmailConflict is returned by Create when the email is already registered
+	ErrEmailConflict = errors.New("email conflict")
+	// ErrUnknownRole is returned when a user is given a role missing from the roles table
+	ErrUnknownRole = errors.New("unknown role")
+)
+
+// postgres error codes
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
 )
 
 type repository struct {
@@ -15,6 +35,42 @@ func NewRepository(db *sql.DB) *repository {
 	return &repository{db: db}
 }
 
+// userColumns is shared by every query that scans a full User row
+const userColumns = `id, email, role, status, status_reason, status_until, password_hash, is_verified, full_name, profile_pic_name, session_version, pending_email, deleted_at, purge_at, created_at, updated_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (*User, error) {
+	var user User
+
+	err := row.Scan(
+		&user.Id,
+		&user.Email,
+		&user.Role,
+		&user.Status,
+		&user.StatusReason,
+		&user.StatusUntil,
+		&user.PasswordHash,
+		&user.IsVerified,
+		&user.FullName,
+		&user.ProfilePicName,
+		&user.SessionVersion,
+		&user.PendingEmail,
+		&user.DeletedAt,
+		&user.PurgeAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 func (r *repository) Create(ctx context.Context, u User) error {
 	// SQLite specific syntax uses ? placeholders
 	// postgres specific syntax uses $1, $2, $3, .... placeholders
@@ -22,31 +78,33 @@ func (r *repository) Create(ctx context.Context, u User) error {
 		email,
 		role,
 		password_hash,
-		refresh_token_hash,
-		refresh_token_expiry,
 		is_verified,
 		full_name,
 		profile_pic_name,
 		created_at,
 		updated_at
 	) VALUES (
-		$1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+		$1, $2, $3, $4, $5, $6, $7, $8
 	)`
 
-	if _, err := r.db.ExecContext(
+	if _, err := txn.Conn(ctx, r.db).ExecContext(
 		ctx,
 		query,
 		u.Email,
 		u.Role,
 		u.PasswordHash,
-		u.RefreshTokenHash,
-		u.RefreshTokenExpiry,
 		u.IsVerified,
 		u.FullName,
 		u.ProfilePicName,
 		u.UpdatedAt,
 		u.UpdatedAt,
 	); err != nil {
+		// a concurrent registration can slip past the service's FindByEmail check
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrEmailConflict
+		}
+
 		return err
 	}
 
@@ -54,42 +112,49 @@ func (r *repository) Create(ctx context.Context, u User) error {
 }
 
 func (r *repository) FindByEmail(ctx context.Context, email string) (*User, error) {
-	var user User
-
-	query := `SELECT id, email, role, password_hash, refresh_token_hash, refresh_token_expiry, is_verified, full_name, profile_pic_name, created_at, updated_at
-	
+	query := `SELECT ` + userColumns + `
 	FROM users
 	WHERE email = $1`
 
-	row := r.db.QueryRowContext(ctx, query, email)
+	return scanUser(txn.Conn(ctx, r.db).QueryRowContext(ctx, query, email))
+}
 
-	err := row.Scan(
-		&user.Id,
-		&user.Email,
-		&user.Role,
-		&user.PasswordHash,
-		&user.RefreshTokenHash,
-		&user.RefreshTokenExpiry,
-		&user.IsVerified,
-		&user.FullName,
-		&user.ProfilePicName,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+func (r *repository) FindById(ctx context.Context, id int64) (*User, error) {
+	query := `SELECT ` + userColumns + `
+	FROM users
+	WHERE id = $1`
+
+	return scanUser(txn.Conn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
 
+func (r *repository) MarkVerified(ctx context.Context, id int64) error {
+	query := `UPDATE users
+              SET is_verified = TRUE, updated_at = NOW()
+              WHERE id = $1`
+
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, id)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to execute update query: %w", err)
 	}
 
-	return &user, nil
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
 }
 
-func (r *repository) SaveRefreshToken(ctx context.Context, email string, hash string, expiry time.Time) error {
-	query := `UPDATE users 
-              SET refresh_token_hash = $1, refresh_token_expiry = $2 
-              WHERE email = $3`
+func (r *repository) UpdatePassword(ctx context.Context, id int64, hash string) error {
+	query := `UPDATE users
+              SET password_hash = $1, updated_at = NOW()
+              WHERE id = $2`
 
-	result, err := r.db.ExecContext(ctx, query, hash, expiry, email)
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, hash, id)
 	if err != nil {
 		return fmt.Errorf("failed to execute update query: %w", err)
 	}
@@ -100,39 +165,412 @@ func (r *repository) SaveRefreshToken(ctx context.Context, email string, hash st
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("user not found with email: %s", email)
+		return sql.ErrNoRows
 	}
 
 	return nil
 }
 
-func (r *repository) FindById(ctx context.Context, id int64) (*User, error) {
-	var user User
+// RevokeSessions invalidates every session issued to the user so far
+// and returns the version new sessions must carry
+func (r *repository) RevokeSessions(ctx context.Context, id int64) (int, error) {
+	var version int
+
+	query := `UPDATE users
+              SET session_version = session_version + 1
+              WHERE id = $1
+              RETURNING session_version`
+
+	if err := txn.Conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// ListProfilePicNames returns the profile picture of every user, for reconciling the file store
+func (r *repository) ListProfilePicNames(ctx context.Context) ([]string, error) {
+	query := `SELECT profile_pic_name FROM users WHERE profile_pic_name <> ''`
+
+	rows, err := txn.Conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute select query: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+func (r *repository) UpdateProfile(ctx context.Context, id int64, fullName string) error {
+	query := `UPDATE users
+              SET full_name = $1, updated_at = NOW()
+              WHERE id = $2`
+
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, fullName, id)
+	if err != nil {
+		return fmt.Errorf("failed to execute update query: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ReplaceProfilePic points the user at a new picture and returns the previous one.
+// The row lock makes concurrent replacements each see the picture they replaced,
+// so every old picture is deleted exactly once.
+func (r *repository) ReplaceProfilePic(ctx context.Context, id int64, profilePicName string) (string, error) {
+	var old string
+
+	query := `UPDATE users u
+              SET profile_pic_name = $1, updated_at = NOW()
+              FROM (SELECT id, profile_pic_name FROM users WHERE id = $2 FOR UPDATE) prev
+              WHERE u.id = prev.id
+              RETURNING prev.profile_pic_name`
+
+	if err := txn.Conn(ctx, r.db).QueryRowContext(ctx, query, profilePicName, id).Scan(&old); err != nil {
+		return "", err
+	}
+
+	return old, nil
+}
+
+// SetPendingEmail stages an email change until ConfirmEmailChange or ClearPendingEmail
+func (r *repository) SetPendingEmail(ctx context.Context, id int64, email string) error {
+	query := `UPDATE users
+              SET pending_email = $1, updated_at = NOW()
+              WHERE id = $2`
+
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, email, id)
+	if err != nil {
+		return fmt.Errorf("failed to execute update query: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange swaps in the pending email. The new address was just proven by
+// the confirmation link, so the user ends up verified. Returns sql.ErrNoRows without
+// a pending email and ErrEmailConflict if the address was taken in the meantime.
+func (r *repository) ConfirmEmailChange(ctx context.Context, id int64) error {
+	query := `UPDATE users
+              SET email = pending_email, pending_email = NULL, is_verified = TRUE, updated_at = NOW()
+              WHERE id = $1 AND pending_email IS NOT NULL`
+
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrEmailConflict
+		}
+
+		return fmt.Errorf("failed to execute update query: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *repository) ClearPendingEmail(ctx context.Context, id int64) error {
+	query := `UPDATE users
+              SET pending_email = NULL, updated_at = NOW()
+              WHERE id = $1`
+
+	if _, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to execute update query: %w", err)
+	}
+
+	return nil
+}
+
+// SoftDelete marks the account deleted until purgeAt and revokes every session
+func (r *repository) SoftDelete(ctx context.Context, id int64, purgeAt time.Time) error {
+	query := `UPDATE users
+              SET status = 'pending_deletion', status_reason = NULL, status_until = NULL,
+                  deleted_at = NOW(), purge_at = $1, session_version = session_version + 1, updated_at = NOW()
+              WHERE id = $2 AND deleted_at IS NULL`
+
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, purgeAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to execute update query: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
 
-	query := `SELECT id, email, role, password_hash, refresh_token_hash, refresh_token_expiry, is_verified, full_name, profile_pic_name, created_at, updated_at
-	
+// RestoreAccount cancels a deletion whose grace period has not run out yet
+func (r *repository) RestoreAccount(ctx context.Context, id int64) error {
+	query := `UPDATE users
+              SET status = 'active', deleted_at = NULL, purge_at = NULL, updated_at = NOW()
+              WHERE id = $1 AND purge_at > NOW()`
+
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to execute update query: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ListPurgeable returns deleted accounts whose grace period is over
+func (r *repository) ListPurgeable(ctx context.Context, limit int) ([]User, error) {
+	query := `SELECT ` + userColumns + `
 	FROM users
-	WHERE id = $1`
+	WHERE purge_at <= NOW()
+	ORDER BY purge_at
+	LIMIT $1`
 
-	row := r.db.QueryRowContext(ctx, query, id)
+	rows, err := txn.Conn(ctx, r.db).QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute select query: %w", err)
+	}
+	defer rows.Close()
 
-	err := row.Scan(
-		&user.Id,
-		&user.Email,
-		&user.Role,
-		&user.PasswordHash,
-		&user.RefreshTokenHash,
-		&user.RefreshTokenExpiry,
-		&user.IsVerified,
-		&user.FullName,
-		&user.ProfilePicName,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	var users []User
+
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, *u)
+	}
+
+	return users, rows.Err()
+}
 
+// HardDelete removes the account with everything referencing it. The purge_at check
+// makes it a no-op for an account restored since it was listed.
+func (r *repository) HardDelete(ctx context.Context, id int64) (bool, error) {
+	query := `DELETE FROM users WHERE id = $1 AND purge_at <= NOW()`
+
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, id)
 	if err != nil {
-		return nil, err
+		return false, fmt.Errorf("failed to execute delete query: %w", err)
 	}
 
-	return &user, nil
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// UpdateRole changes the role of the user. Their sessions pick it up on the next request.
+func (r *repository) UpdateRole(ctx context.Context, id int64, role string) error {
+	query := `UPDATE users
+              SET role = $1, updated_at = NOW()
+              WHERE id = $2`
+
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, role, id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return ErrUnknownRole
+		}
+
+		return fmt.Errorf("failed to execute update query: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ListRolePermissions returns the permissions granted to a role, none for an unknown role
+func (r *repository) ListRolePermissions(ctx context.Context, role string) ([]string, error) {
+	query := `SELECT permission FROM role_permissions WHERE role = $1 ORDER BY permission`
+
+	rows, err := txn.Conn(ctx, r.db).QueryContext(ctx, query, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute select query: %w", err)
+	}
+	defer rows.Close()
+
+	var permissions []string
+
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+// SetStatus moves the account to another state, with an optional reason and end. Leaving
+// the active state revokes every session. Accounts pending deletion are left alone.
+func (r *repository) SetStatus(ctx context.Context, id int64, status string, reason *string, until *time.Time) error {
+	revoke := 0
+	if status != StatusActive {
+		revoke = 1
+	}
+
+	query := `UPDATE users
+              SET status = $1, status_reason = $2, status_until = $3,
+                  session_version = session_version + $4, updated_at = NOW()
+              WHERE id = $5 AND deleted_at IS NULL`
+
+	result, err := txn.Conn(ctx, r.db).ExecContext(ctx, query, status, reason, until, revoke, id)
+	if err != nil {
+		return fmt.Errorf("failed to execute update query: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Search returns a page of the users matching the filter, newest first, with the total number of matches
+func (r *repository) Search(ctx context.Context, f Filter) ([]User, int, error) {
+	var conditions []string
+	var args []any
+
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.Role != "" {
+		where("role = $%d", f.Role)
+	}
+
+	if f.IsVerified != nil {
+		where("is_verified = $%d", *f.IsVerified)
+	}
+
+	if f.CreatedAfter != nil {
+		where("created_at >= $%d", *f.CreatedAfter)
+	}
+
+	if f.CreatedBefore != nil {
+		where("created_at < $%d", *f.CreatedBefore)
+	}
+
+	if query := prefixTsQuery(f.Query); query != "" {
+		where("search_vector @@ to_tsquery('simple', $%d)", query)
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+
+	if err := txn.Conn(ctx, r.db).QueryRowContext(ctx, `SELECT COUNT(*) FROM users `+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	query := `SELECT ` + userColumns + `
+	FROM users
+	` + whereClause + `
+	ORDER BY created_at DESC, id DESC
+	LIMIT ` + strconv.Itoa(f.Limit) + ` OFFSET ` + strconv.Itoa(f.Offset)
+
+	rows, err := txn.Conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to execute select query: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		users = append(users, *u)
+	}
+
+	return users, total, rows.Err()
+}
+
+// prefixTsQuery turns free text into a tsquery matching every word as a prefix,
+// e.g. "jane@exa" becomes "jane:* & exa:*". Only letters and digits survive,
+// so the result is always a valid tsquery.
+func prefixTsQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+
+	return strings.Join(words, " & ")
 }
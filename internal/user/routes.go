@@ -5,5 +5,10 @@ import "net/http"
 func (h *Handler) RegisterRoutes() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /profile", h.requireAuth(h.Profile))
+	mux.HandleFunc("PATCH /profile", h.requireAuth(h.UpdateProfile))
+	mux.HandleFunc("GET /profile-pic", h.requireAuth(h.ProfilePic))
+	mux.HandleFunc("PUT /profile-pic", h.requireAuth(h.ReplaceProfilePic))
+	mux.HandleFunc("GET /profile-pic/url", h.requireAuth(h.ProfilePicUrl))
+	mux.HandleFunc("GET /users/{id}/profile-pic", h.PublicProfilePic)
 	return mux
 }
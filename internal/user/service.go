@@ -1 +1,56 @@
 package user
+
+import (
+	"context"
+	"io"
+)
+
+// UpdateProfileInput holds the editable profile fields, nil ones are left unchanged
+type UpdateProfileInput struct {
+	FullName *string
+}
+
+type service struct {
+	repo           Repository
+	fileStore      FileStore
+	profilePicPath string
+}
+
+func NewService(repo Repository, fs FileStore, profilePicPath string) *service {
+	return &service{
+		repo:           repo,
+		fileStore:      fs,
+		profilePicPath: profilePicPath,
+	}
+}
+
+func (s *service) UpdateProfile(ctx context.Context, id int64, in UpdateProfileInput) (*User, error) {
+	if in.FullName != nil {
+		if err := s.repo.UpdateProfile(ctx, id, *in.FullName); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.repo.FindById(ctx, id)
+}
+
+// ReplaceProfilePic uploads the new picture before switching the user over to it,
+// so the profile never points at a missing object. The old picture is deleted afterwards.
+func (s *service) ReplaceProfilePic(ctx context.Context, id int64, file io.Reader) (*User, error) {
+	profilePicName, err := UploadProfilePic(ctx, s.fileStore, s.profilePicPath, file)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := s.repo.ReplaceProfilePic(ctx, id, profilePicName)
+	if err != nil {
+		DeleteProfilePic(ctx, s.fileStore, profilePicName)
+		return nil, err
+	}
+
+	if old != "" {
+		DeleteProfilePic(ctx, s.fileStore, old)
+	}
+
+	return s.repo.FindById(ctx, id)
+}
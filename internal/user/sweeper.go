@@ -0,0 +1,85 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/imageproc"
+	"github.com/5hishirH/go-auth-rest-api.git/internal/shared/storage/filestore"
+)
+
+type ProfilePicLister interface {
+	ListProfilePicNames(ctx context.Context) ([]string, error)
+}
+
+type SweepableFileStore interface {
+	List(ctx context.Context, prefix string) ([]filestore.ObjectInfo, error)
+	Delete(ctx context.Context, objectName string) error
+}
+
+// Sweeper deletes profile pictures no user references, e.g. left behind by a crash
+// between the upload and the insert of the user row
+type Sweeper struct {
+	repo      ProfilePicLister
+	fileStore SweepableFileStore
+	prefix    string
+	// minAge protects uploads whose user row is not committed yet
+	minAge time.Duration
+}
+
+func NewSweeper(repo ProfilePicLister, fs SweepableFileStore, prefix string, minAge time.Duration) *Sweeper {
+	return &Sweeper{
+		repo:      repo,
+		fileStore: fs,
+		prefix:    prefix,
+		minAge:    minAge,
+	}
+}
+
+// Sweep returns the orphaned objects, deleting them unless dryRun is set
+func (s *Sweeper) Sweep(ctx context.Context, dryRun bool) ([]string, error) {
+	// list the objects first, anything uploaded after this point is too young to be swept anyway
+	objects, err := s.fileStore.List(ctx, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := s.repo.ListProfilePicNames(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list profile pictures: %w", err)
+	}
+
+	// a user references the original and every resized variant of it
+	referenced := make(map[string]bool, len(names))
+	for _, name := range names {
+		for _, objectName := range imageproc.ObjectNames(name) {
+			referenced[objectName] = true
+		}
+	}
+
+	cutoff := time.Now().Add(-s.minAge)
+
+	var orphans []string
+
+	for _, obj := range objects {
+		if referenced[obj.Name] || obj.LastModified.After(cutoff) {
+			continue
+		}
+
+		orphans = append(orphans, obj.Name)
+
+		if dryRun {
+			continue
+		}
+
+		if err := s.fileStore.Delete(ctx, obj.Name); err != nil {
+			return orphans, fmt.Errorf("failed to delete %s: %w", obj.Name, err)
+		}
+
+		log.Printf("deleted orphaned profile picture %s", obj.Name)
+	}
+
+	return orphans, nil
+}
@@ -0,0 +1,4 @@
+ALTER TABLE users
+ADD COLUMN refresh_token_family TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_users_refresh_token_family ON users(refresh_token_family);
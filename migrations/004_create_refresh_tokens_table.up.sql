@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id TEXT NOT NULL UNIQUE,
+    token_hash TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+
+DROP INDEX IF EXISTS idx_users_refresh_token_family;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS refresh_token_hash,
+DROP COLUMN IF EXISTS refresh_token_expiry,
+DROP COLUMN IF EXISTS refresh_token_family;
@@ -0,0 +1,2 @@
+ALTER TABLE users
+ADD COLUMN session_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE users
+ADD COLUMN pending_email VARCHAR(255);
@@ -0,0 +1,9 @@
+ALTER TABLE users
+ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active',
+ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('simple', COALESCE(full_name, '') || ' ' || email || ' ' || translate(email, '@.+_-', '     '))
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN(search_vector);
+
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(created_at);
@@ -0,0 +1,8 @@
+ALTER TABLE users
+ADD COLUMN status_reason TEXT,
+ADD COLUMN status_until TIMESTAMPTZ;
+
+UPDATE users SET status = 'pending_deletion' WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE users
+ADD CONSTRAINT chk_users_status CHECK (status IN ('active', 'suspended', 'locked', 'pending_deletion'));
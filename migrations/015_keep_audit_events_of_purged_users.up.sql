@@ -0,0 +1,4 @@
+ALTER TABLE audit_events
+ALTER COLUMN user_id DROP NOT NULL,
+DROP CONSTRAINT IF EXISTS audit_events_user_id_fkey,
+ADD CONSTRAINT audit_events_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE email_outbox
+ALTER COLUMN text_body DROP NOT NULL,
+ALTER COLUMN html_body DROP NOT NULL;
+
+UPDATE email_outbox SET text_body = NULL, html_body = NULL WHERE status IN ('sent', 'failed');
+
+CREATE INDEX IF NOT EXISTS idx_email_outbox_status_created_at ON email_outbox(status, created_at);